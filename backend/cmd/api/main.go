@@ -33,6 +33,8 @@ func main() {
 	// Slack bind
 	mux.Handle("/api/me/slack/start", authpkg.WithAuth(app, http.HandlerFunc(h.PostSlackStart(app))))
 	mux.Handle("/api/me/slack/verify", authpkg.WithAuth(app, http.HandlerFunc(h.PostSlackVerify(app))))
+	mux.Handle("/api/me/slack/rebind", authpkg.WithAuth(app, http.HandlerFunc(h.PostSlackRebind(app))))
+	mux.Handle("/api/me/slack/unbind", authpkg.WithAuth(app, http.HandlerFunc(h.PostSlackUnbind(app))))
 
 	// Admin (OWNER only)
 	mux.HandleFunc("/api/admin/invitations", h.PostAdminInvitations(appWrapper))
@@ -0,0 +1,71 @@
+// evaluate はゴールデンセットを使って検索と回答生成の品質を測定する
+//
+//	go run ./cmd/evaluate -golden eval/golden.json -k 5 -provider dummy
+//
+// 結果は -out に保存され、次回実行時に前回との差分が表示される。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"slack-bot/backend/internal/ai"
+	"slack-bot/backend/internal/config"
+	"slack-bot/backend/internal/db"
+	"slack-bot/backend/internal/evaluation"
+	"slack-bot/backend/internal/knowledge"
+)
+
+func main() {
+	golden := flag.String("golden", "eval/golden.json", "golden set (JSON array of {id, question, expected_ids, reference_answer})")
+	k := flag.Int("k", 5, "cutoff for recall@k")
+	provider := flag.String("provider", "", "AI provider to use (openai|dummy); defaults to AI_PROVIDER")
+	out := flag.String("out", "eval/last_run.json", "where to write the report")
+	previous := flag.String("previous", "", "report to compare against (defaults to -out)")
+	flag.Parse()
+
+	if *provider != "" {
+		os.Setenv("AI_PROVIDER", *provider)
+	}
+	if *previous == "" {
+		*previous = *out
+	}
+
+	cases, err := evaluation.LoadGoldenSet(*golden)
+	if err != nil {
+		log.Fatalf("Failed to load golden set: %v", err)
+	}
+
+	// 前回の結果は上書き前に読んでおく
+	prev, err := evaluation.LoadReport(*previous)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to load previous report: %v", err)
+	}
+
+	cfg := config.Load()
+	database := db.Connect(cfg)
+	defer database.Close()
+
+	// 回答キャッシュは使わない（AnswerCacheTTL 0）。毎回検索と生成を評価する。
+	// evaluation.Run は DryRun で問い合わせるため、質問履歴やナレッジ不足レポートにも残らない
+	repo := knowledge.NewRepository(database)
+	service := knowledge.NewService(repo, knowledge.Options{
+		RedactionEnabled: cfg.RedactionEnabled,
+		RedactionRules:   cfg.RedactionRules,
+	})
+
+	report := evaluation.Run(context.Background(), service, cases, *k, ai.Provider())
+	evaluation.PrintReport(os.Stdout, report)
+
+	if prev != nil {
+		evaluation.PrintDiff(os.Stdout, evaluation.Compare(prev, report))
+	}
+
+	if err := report.Save(*out); err != nil {
+		log.Fatalf("Failed to save report: %v", err)
+	}
+	log.Printf("Report written to %s", *out)
+}
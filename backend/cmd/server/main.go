@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// ダイジェストの組織ごとのタイムゾーンを解決するため、OS にタイムゾーンデータがなくても動くようにする
+	_ "time/tzdata"
+
+	apppkg "slack-bot/backend/internal/app"
+	"slack-bot/backend/internal/auth"
 	"slack-bot/backend/internal/config"
 	"slack-bot/backend/internal/db"
 	"slack-bot/backend/internal/handlers"
@@ -71,8 +81,7 @@ func main() {
 	log.Println("Starting Slack Knowledge Bot backend...")
 
 	// セキュリティ設定の検証
-	securityConfig, err := security.ValidateSecurityConfig()
-	if err != nil {
+	if _, err := security.ValidateSecurityConfig(); err != nil {
 		log.Fatalf("Security validation failed: %v", err)
 	}
 	log.Println("Security configuration validated successfully")
@@ -87,44 +96,126 @@ func main() {
 
 	// リポジトリ & サービス & ハンドラ
 	repo := knowledge.NewRepository(database)
-	service := knowledge.NewService(repo)
+	service := knowledge.NewService(repo, knowledge.Options{
+		AutoMetadata:         cfg.AutoMetadata,
+		DuplicateMode:        knowledge.ParseDuplicateMode(cfg.DuplicateMode),
+		DuplicateThreshold:   cfg.DuplicateThreshold,
+		RedactionEnabled:     cfg.RedactionEnabled,
+		RedactionRules:       cfg.RedactionRules,
+		AnswerCacheTTL:       cfg.AnswerCacheTTL,
+		AnswerCacheThreshold: cfg.AnswerCacheThreshold,
+	})
 	handler := knowledge.NewHandler(service)
 
+	// 全文検索インデックスが未作成のナレッジを補完
+	if n, err := service.ReindexSearch(); err != nil {
+		log.Printf("Failed to build search index: %v", err)
+	} else if n > 0 {
+		log.Printf("Built search index for %d knowledge entries", n)
+	}
+
 	// ヘルスチェック（レート制限なし）
 	http.HandleFunc("/health", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		fmt.Fprintln(w, `{"status":"ok","service":"slack-knowledge-bot","security":"enabled"}`)
 	}))
 
+	// ログイン中であれば、操作する人の組織の伏せ字ルールで外部AIを呼び出す
+	authApp := apppkg.New(database)
+	withUser := func(next http.HandlerFunc) http.HandlerFunc {
+		return auth.Identify(authApp, next).ServeHTTP
+	}
+	// ログインを必須とし、操作する人と組織をセッションから決める
+	requireUser := func(next http.HandlerFunc) http.HandlerFunc {
+		return auth.RequireAuth(authApp, next).ServeHTTP
+	}
+
 	// Knowledge API endpoints（一般的なレート制限）
-	http.HandleFunc("/knowledge", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleKnowledge)))
-	http.HandleFunc("/knowledge/", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleKnowledgeByID)))
-	http.HandleFunc("/knowledge/regenerate-embeddings", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleRegenerateEmbeddings)))
-	http.HandleFunc("/ask", corsMiddleware(middleware.RateLimitMiddleware(middleware.SearchRateLimiter)(handler.HandleAsk)))
+	http.HandleFunc("/knowledge", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleKnowledge))))
+	http.HandleFunc("/knowledge/", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleKnowledgeByID))))
+	http.HandleFunc("/knowledge/regenerate-embeddings", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleRegenerateEmbeddings))))
+	http.HandleFunc("/knowledge/merge", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleMerge))))
+	http.HandleFunc("/ask", corsMiddleware(middleware.RateLimitMiddleware(middleware.SearchRateLimiter)(withUser(handler.HandleAsk))))
+	http.HandleFunc("/ask/feedback", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(requireUser(handler.HandleFeedback))))
 
 	// Frontend API endpoints with /api prefix
-	http.HandleFunc("/api/knowledge", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleKnowledge)))
-	http.HandleFunc("/api/knowledge/", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleKnowledgeByID)))
-	http.HandleFunc("/api/ask", corsMiddleware(middleware.RateLimitMiddleware(middleware.SearchRateLimiter)(handler.HandleAsk)))
+	http.HandleFunc("/api/knowledge", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleKnowledge))))
+	http.HandleFunc("/api/knowledge/", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleKnowledgeByID))))
+	http.HandleFunc("/api/knowledge/merge", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(withUser(handler.HandleMerge))))
+	http.HandleFunc("/api/ask", corsMiddleware(middleware.RateLimitMiddleware(middleware.SearchRateLimiter)(withUser(handler.HandleAsk))))
+	http.HandleFunc("/api/ask/feedback", corsMiddleware(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(requireUser(handler.HandleFeedback))))
 
 	// Admin API endpoints (内部完結)
 	app := &handlers.App{DB: database}
 	http.HandleFunc("/api/admin/users", corsMiddleware(handlers.GetAdminUsers(app)))
 	http.HandleFunc("/api/admin/invitations", corsMiddleware(handlers.CreateInvitation(app)))
+
+	// 組織のオーナー向けの管理API（対象の組織はログイン中のユーザーの組織）
+	ownerOnly := func(next http.HandlerFunc) http.HandlerFunc {
+		return corsMiddleware(auth.RequireOwner(authApp, next).ServeHTTP)
+	}
+	http.HandleFunc("/api/admin/knowledge-gaps", ownerOnly(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleGapReport)))
+	http.HandleFunc("/api/admin/knowledge-gaps/draft", ownerOnly(middleware.RateLimitMiddleware(middleware.GeneralRateLimiter)(handler.HandleGapDraft)))
+	http.HandleFunc("/api/admin/slack/metrics", ownerOnly(slack.HandleMetrics))
+	http.HandleFunc("/api/admin/slack/digests", ownerOnly(slack.HandleDigestSettings))
+	http.HandleFunc("/api/admin/slack/identity-conflicts", ownerOnly(slack.HandleIdentityConflicts))
+	http.HandleFunc("/api/admin/slack/identity-sync", ownerOnly(slack.HandleIdentitySync))
+	http.HandleFunc("/api/admin/slack/experts", ownerOnly(slack.HandleExperts))
 	http.HandleFunc("/api/auth/invitations", corsMiddleware(handlers.GetInvitation(app)))
 	http.HandleFunc("/api/auth/accept-invite", corsMiddleware(handlers.AcceptInvitation(app)))
 
 	// Slack連携
-	slack.RegisterSlackHandlers(corsMiddleware)
+	slack.RegisterSlackHandlers(corsMiddleware, slack.Options{
+		Knowledge:       service,
+		Workers:         cfg.SlackWorkers,
+		QueueSize:       cfg.SlackQueueSize,
+		DB:              database,
+		ClientID:        cfg.SlackClientID,
+		ClientSecret:    cfg.SlackClientSecret,
+		RedirectURL:     cfg.SlackRedirectURL,
+		Scopes:          cfg.SlackScopes,
+		DefaultTeamID:   cfg.SlackDefaultTeamID,
+		DefaultOrgID:    cfg.SlackDefaultOrgID,
+		AutoLinkByEmail: cfg.SlackAutoLink,
+		Auth:            authApp,
+	})
 
 	log.Printf("Server starting on port %s", cfg.Port)
 	log.Printf("Available endpoints:")
 	log.Printf("  - Health: /health")
 	log.Printf("  - Knowledge: /knowledge, /api/knowledge")
 	log.Printf("  - Ask: /ask, /api/ask")
-	log.Printf("  - Slack: /slack/commands")
+	log.Printf("  - Slack: /slack/commands, /slack/events, /slack/interactions, /slack/install, /slack/oauth/callback")
+
+	// 新着ナレッジ・未回答の質問のダイジェストを定期投稿
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go slack.RunDigestScheduler(jobsCtx, time.Minute)
+	// メールアドレスが一致する Slack アカウントへの自動連携
+	if cfg.SlackAutoLink {
+		go slack.RunIdentitySync(jobsCtx, cfg.SlackIdentitySyncInterval)
+	}
 
-	if err := http.ListenAndServe(":"+cfg.Port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	server := &http.Server{Addr: ":" + cfg.Port}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	// SIGINT / SIGTERM で新しいリクエストの受付を止め、処理中の Slack の応答を送り終えてから終了する
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("Shutting down...")
+	stopJobs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+	if err := slack.Shutdown(ctx); err != nil {
+		log.Printf("Slack worker shutdown: %v", err)
 	}
+	log.Println("Server stopped")
 }
@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 )
 
@@ -26,12 +25,17 @@ type EmbeddingResponse struct {
 
 // GenerateEmbedding generates an embedding for the given text using OpenAI API
 func GenerateEmbedding(ctx context.Context, input string) ([]float32, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		// Return dummy embedding for testing when API key is not set
+	apiKey, ok := openAIKey()
+	if !ok {
+		// Return dummy embedding for testing when API key is not set (or AI_PROVIDER=dummy)
 		return generateDummyEmbedding(input), nil
 	}
 
+	// 外部送信前に個人情報・秘密情報を伏せ字にする
+	session := newRedactionSession(ctx)
+	input = session.Redact(input)
+	logRedactions("embedding", session)
+
 	reqBody, err := json.Marshal(EmbeddingRequest{
 		Input: input,
 		Model: "text-embedding-3-small", // OpenAI recommended lightweight model
@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Metadata is the suggested title, summary and keywords for a knowledge entry
+type Metadata struct {
+	Title    string   `json:"title"`
+	Summary  string   `json:"summary"`
+	Keywords []string `json:"keywords"`
+}
+
+const (
+	maxTitleRunes   = 40
+	maxSummaryRunes = 100
+	maxKeywords     = 5
+)
+
+// GenerateMetadata suggests a title, a short summary and keywords for the given knowledge
+func GenerateMetadata(ctx context.Context, title, content string) (*Metadata, error) {
+	apiKey, ok := openAIKey()
+	if !ok {
+		// APIキーがない場合は決定的なダミーを返す
+		return generateDummyMetadata(title, content), nil
+	}
+
+	// 外部送信前に個人情報・秘密情報を伏せ字にする
+	session := newRedactionSession(ctx)
+	title = session.Redact(title)
+	content = session.Redact(content)
+	logRedactions("metadata generation", session)
+
+	systemPrompt := `あなたは社内ナレッジベースの編集者です。与えられたナレッジについて以下をJSONで返してください：
+
+- "title": 内容を的確に表す40文字以内のタイトル
+- "summary": 100文字以内の要約
+- "keywords": 検索に役立つキーワード（最大5個）
+
+本文に書かれていない情報は追加しないでください。`
+
+	userPrompt := fmt.Sprintf("現在のタイトル: %s\n\n本文:\n%s", title, content)
+
+	raw, err := complete(ctx, apiKey, chatRequest{
+		Model: "gpt-4o-mini",
+		Messages: []chatMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		ResponseFormat: &responseFormat{Type: "json_object"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal([]byte(raw), &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	meta.Title = session.Restore(meta.Title)
+	meta.Summary = session.Restore(meta.Summary)
+	for i, k := range meta.Keywords {
+		meta.Keywords[i] = session.Restore(k)
+	}
+
+	return normalizeMetadata(&meta), nil
+}
+
+// generateDummyMetadata derives metadata from the text itself for testing without an API key
+func generateDummyMetadata(title, content string) *Metadata {
+	firstLine := strings.TrimSpace(strings.SplitN(strings.TrimSpace(content), "\n", 2)[0])
+	if firstLine == "" {
+		firstLine = title
+	}
+
+	var keywords []string
+	seen := map[string]bool{}
+	for _, w := range strings.Fields(strings.ToLower(title + " " + content)) {
+		w = strings.Trim(w, "。、,.!?！？「」()（）")
+		if len([]rune(w)) < 2 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		keywords = append(keywords, w)
+	}
+
+	return normalizeMetadata(&Metadata{
+		Title:    firstLine,
+		Summary:  strings.Join(strings.Fields(content), " "),
+		Keywords: keywords,
+	})
+}
+
+// normalizeMetadata trims every field to its length limit
+func normalizeMetadata(meta *Metadata) *Metadata {
+	meta.Title = truncateRunes(strings.TrimSpace(meta.Title), maxTitleRunes)
+	meta.Summary = truncateRunes(strings.TrimSpace(meta.Summary), maxSummaryRunes)
+
+	var keywords []string
+	for _, k := range meta.Keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+		if len(keywords) == maxKeywords {
+			break
+		}
+	}
+	meta.Keywords = keywords
+	return meta
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-3]) + "..."
+}
@@ -0,0 +1,33 @@
+package ai
+
+import (
+	"os"
+	"strings"
+)
+
+// AI_PROVIDER で使用するプロバイダを選択する。
+//   - "openai": OpenAI API（OPENAI_API_KEY が必要）
+//   - "dummy":  決定的なダミー実装（CI・評価用）
+//
+// 未設定の場合は OPENAI_API_KEY があれば openai、なければ dummy を使う。
+const (
+	ProviderOpenAI = "openai"
+	ProviderDummy  = "dummy"
+)
+
+// Provider は現在有効なプロバイダ名を返す
+func Provider() string {
+	if _, ok := openAIKey(); ok {
+		return ProviderOpenAI
+	}
+	return ProviderDummy
+}
+
+// openAIKey は OpenAI を使う場合に API キーを返す
+func openAIKey() (string, bool) {
+	if strings.EqualFold(os.Getenv("AI_PROVIDER"), ProviderDummy) {
+		return "", false
+	}
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	return apiKey, apiKey != ""
+}
@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"context"
+	"log"
+
+	"slack-bot/backend/internal/security"
+)
+
+type redactorKey struct{}
+
+// defaultRedactor はコンテキストで指定がない場合に使う組み込みルールのみの Redactor
+var defaultRedactor, _ = security.NewRedactor(security.DefaultRedactionRules)
+
+// WithRedactor は外部AI呼び出しの前に適用する Redactor をコンテキストに設定する。
+// ルールが空の Redactor を設定すると伏せ字処理は行われない。
+func WithRedactor(ctx context.Context, r *security.Redactor) context.Context {
+	return context.WithValue(ctx, redactorKey{}, r)
+}
+
+// HasRedactor はコンテキストに Redactor が設定済みかどうかを返す
+func HasRedactor(ctx context.Context) bool {
+	r, ok := ctx.Value(redactorKey{}).(*security.Redactor)
+	return ok && r != nil
+}
+
+// newRedactionSession はコンテキストの Redactor からセッションを作る
+func newRedactionSession(ctx context.Context) *security.RedactionSession {
+	if r, ok := ctx.Value(redactorKey{}).(*security.Redactor); ok && r != nil {
+		return r.NewSession()
+	}
+	return defaultRedactor.NewSession()
+}
+
+// logRedactions は伏せ字にした件数をログに残す（値そのものは出力しない）
+func logRedactions(call string, session *security.RedactionSession) {
+	if total := session.Total(); total > 0 {
+		log.Printf("Redacted %d item(s) before %s: %v", total, call, session.Counts())
+	}
+}
+
+// CountRedactions は texts を外部AIに送る際に伏せ字になる件数を返す。
+// 伏せ字を復元した回答を他の利用者に使い回さないよう、キャッシュ可否の判定に使う
+func CountRedactions(ctx context.Context, texts ...string) int {
+	session := newRedactionSession(ctx)
+	for _, t := range texts {
+		session.Redact(t)
+	}
+	return session.Total()
+}
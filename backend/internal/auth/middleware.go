@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"slack-bot/backend/internal/app"
@@ -13,39 +14,79 @@ import (
 
 type ctxKey string
 
-const userIDKey ctxKey = "uid"
+const (
+	userIDKey ctxKey = "uid"
+	userKey   ctxKey = "user"
+)
+
+// roleOwner は組織の管理者ロール（招待と auth サービスで大文字・小文字が異なる）
+const roleOwner = "OWNER"
 
 func WithAuth(a *app.App, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c, err := r.Cookie("session")
-		if err != nil || c.Value == "" {
+		uid, ok := sessionUserID(r, a)
+		if !ok {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		h := cryptopkg.Hash(c.Value)
-		s, err := dbpkg.GetSession(r.Context(), a.DB, h)
-		if err != nil || s.ExpiresAt.Before(time.Now()) {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		ctx := context.WithValue(r.Context(), userIDKey, uid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Identify はログイン中であればユーザーをコンテキストに載せ、未ログインでもそのまま通す
+func Identify(a *app.App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, ok := sessionUserID(r, a)
+		if !ok {
+			next.ServeHTTP(w, r)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userIDKey, s.UserID)
+		ctx := context.WithValue(r.Context(), userIDKey, uid)
+		if u, err := dbpkg.GetUserByID(ctx, a.DB, uid); err == nil && u.IsActive {
+			ctx = context.WithValue(ctx, userKey, u)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func RequireOwner(a *app.App, next http.Handler) http.Handler {
+// RequireAuth はログイン中の有効なユーザーのみ通し、ユーザーをコンテキストに載せる
+func RequireAuth(a *app.App, next http.Handler) http.Handler {
 	return WithAuth(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// uid := r.Context().Value(userIDKey).(string)
-		// TODO: Implement GetUserByID
-		// u, err := dbpkg.GetUserByID(r.Context(), a.DB, uid)
-		// if err != nil || u.Role != "OWNER" {
-		// 	http.Error(w, "forbidden", http.StatusForbidden)
-		// 	return
-		// }
+		u, err := dbpkg.GetUserByID(r.Context(), a.DB, CurrentUserID(r))
+		if err != nil || !u.IsActive {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userKey, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+func RequireOwner(a *app.App, next http.Handler) http.Handler {
+	return RequireAuth(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(CurrentUser(r).Role, roleOwner) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	}))
 }
 
+// sessionUserID はセッション Cookie が有効であればそのユーザーIDを返す
+func sessionUserID(r *http.Request, a *app.App) (string, bool) {
+	c, err := r.Cookie("session")
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	h := cryptopkg.Hash(c.Value)
+	s, err := dbpkg.GetSession(r.Context(), a.DB, h)
+	if err != nil || s.ExpiresAt.Before(time.Now()) {
+		return "", false
+	}
+	return s.UserID, true
+}
+
 func CurrentUserID(r *http.Request) string {
 	v := r.Context().Value(userIDKey)
 	if v == nil {
@@ -54,6 +95,20 @@ func CurrentUserID(r *http.Request) string {
 	return v.(string)
 }
 
+// CurrentUser は RequireAuth・RequireOwner・Identify が読み込んだユーザー（未ログインなら nil）
+func CurrentUser(r *http.Request) *dbpkg.User {
+	u, _ := r.Context().Value(userKey).(*dbpkg.User)
+	return u
+}
+
+// CurrentOrgID はログイン中のユーザーの組織（未ログインなら 0）
+func CurrentOrgID(r *http.Request) int64 {
+	if u := CurrentUser(r); u != nil {
+		return u.OrgID
+	}
+	return 0
+}
+
 func JSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,6 +16,28 @@ type Config struct {
 	DBName       string
 	OpenAIAPIKey string
 	SlackSecret  string
+	AutoMetadata bool
+
+	DuplicateMode      string
+	DuplicateThreshold float64
+
+	RedactionEnabled bool
+	RedactionRules   []string
+
+	AnswerCacheTTL       time.Duration
+	AnswerCacheThreshold float64
+
+	SlackClientID      string
+	SlackClientSecret  string
+	SlackRedirectURL   string
+	SlackScopes        []string
+	SlackDefaultTeamID string
+	SlackDefaultOrgID  int64
+	SlackWorkers       int
+	SlackQueueSize     int
+
+	SlackAutoLink             bool
+	SlackIdentitySyncInterval time.Duration
 }
 
 func Load() *Config {
@@ -25,6 +50,28 @@ func Load() *Config {
 		DBName:       getEnv("DB_NAME", "slackbot"),
 		OpenAIAPIKey: getEnv("OPENAI_API_KEY", ""),
 		SlackSecret:  getEnv("SLACK_SIGNING_SECRET", ""),
+		AutoMetadata: getEnv("KNOWLEDGE_AUTO_METADATA", "false") == "true",
+
+		DuplicateMode:      getEnv("KNOWLEDGE_DUPLICATE_MODE", "warn"),
+		DuplicateThreshold: getEnvFloat("KNOWLEDGE_DUPLICATE_THRESHOLD", 0.92),
+
+		RedactionEnabled: getEnv("REDACTION_ENABLED", "true") == "true",
+		RedactionRules:   getEnvList("REDACTION_RULES", "api_key,credit_card,email,phone"),
+
+		AnswerCacheTTL:       getEnvDuration("ANSWER_CACHE_TTL", 24*time.Hour),
+		AnswerCacheThreshold: getEnvFloat("ANSWER_CACHE_THRESHOLD", 0.95),
+
+		SlackClientID:      getEnv("SLACK_CLIENT_ID", ""),
+		SlackClientSecret:  getEnv("SLACK_CLIENT_SECRET", ""),
+		SlackRedirectURL:   getEnv("SLACK_REDIRECT_URL", ""),
+		SlackScopes:        getEnvList("SLACK_SCOPES", "commands,chat:write,app_mentions:read,im:history,channels:history,groups:history,im:write,users:read,users:read.email"),
+		SlackDefaultTeamID: getEnv("SLACK_DEFAULT_TEAM_ID", ""),
+		SlackDefaultOrgID:  getEnvInt64("SLACK_DEFAULT_ORG_ID", 0),
+		SlackWorkers:       int(getEnvInt64("SLACK_WORKERS", 8)),
+		SlackQueueSize:     int(getEnvInt64("SLACK_QUEUE_SIZE", 100)),
+
+		SlackAutoLink:             getEnv("SLACK_AUTO_LINK_BY_EMAIL", "false") == "true",
+		SlackIdentitySyncInterval: getEnvDuration("SLACK_IDENTITY_SYNC_INTERVAL", 6*time.Hour),
 	}
 }
 
@@ -34,3 +81,40 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func getEnvInt64(key string, fallback int64) int64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getEnvList(key, fallback string) []string {
+	var out []string
+	for _, v := range strings.Split(getEnv(key, fallback), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"fmt"
+	"math/big"
 )
 
 func NewToken(n int) (plain string, hash []byte, err error) {
@@ -20,3 +22,14 @@ func Hash(s string) []byte {
 	h := sha256.Sum256([]byte(s))
 	return h[:]
 }
+
+// NewCode は digits 桁の数字の確認コードとそのハッシュを返す
+func NewCode(digits int) (plain string, hash []byte, err error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", nil, err
+	}
+	plain = fmt.Sprintf("%0*d", digits, n)
+	return plain, Hash(plain), nil
+}
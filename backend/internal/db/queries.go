@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type User struct {
 	Email     string         `json:"email"`
 	SlackID   sql.NullString `json:"slack_id"`
 	Role      string         `json:"role"`
+	OrgID     int64          `json:"org_id"`
 	IsActive  bool           `json:"is_active"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -35,12 +37,23 @@ type Invitation struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// SlackBindRequest is a pending Slack account binding awaiting its verification code
+type SlackBindRequest struct {
+	UserID    string    `json:"user_id"`
+	SlackID   string    `json:"slack_id"`
+	CodeHash  []byte    `json:"-"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // UserRow for admin list
 type UserRow struct {
 	ID        string
 	Name      string
 	Email     string
 	Role      string
+	OrgID     int64
 	SlackID   sql.NullString
 	IsActive  bool
 	CreatedAt time.Time
@@ -49,8 +62,8 @@ type UserRow struct {
 func GetUserByEmail(ctx context.Context, db *sql.DB, email string) (*User, error) {
 	u := &User{}
 	var slack sql.NullString
-	err := db.QueryRowContext(ctx, `SELECT id,name,email,slack_id,role,is_active,created_at,updated_at FROM users WHERE email=$1`, email).
-		Scan(&u.ID, &u.Name, &u.Email, &slack, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+	err := db.QueryRowContext(ctx, `SELECT id,name,email,slack_id,role,COALESCE(org_id,0),is_active,created_at,updated_at FROM users WHERE email=$1`, email).
+		Scan(&u.ID, &u.Name, &u.Email, &slack, &u.Role, &u.OrgID, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +71,28 @@ func GetUserByEmail(ctx context.Context, db *sql.DB, email string) (*User, error
 	return u, nil
 }
 
+// GetUserBySlackID returns the user who bound the Slack ID (sql.ErrNoRows if none)
+func GetUserBySlackID(ctx context.Context, db *sql.DB, slackID string) (*User, error) {
+	u := &User{}
+	err := db.QueryRowContext(ctx, `SELECT id,name,email,slack_id,role,COALESCE(org_id,0),is_active,created_at,updated_at FROM users WHERE slack_id=$1`, slackID).
+		Scan(&u.ID, &u.Name, &u.Email, &u.SlackID, &u.Role, &u.OrgID, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GetUserByID returns the user (sql.ErrNoRows if none)
+func GetUserByID(ctx context.Context, db *sql.DB, id string) (*User, error) {
+	u := &User{}
+	err := db.QueryRowContext(ctx, `SELECT id,name,email,slack_id,role,COALESCE(org_id,0),is_active,created_at,updated_at FROM users WHERE id=$1`, id).
+		Scan(&u.ID, &u.Name, &u.Email, &u.SlackID, &u.Role, &u.OrgID, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 func UpdateUserRoleActive(ctx context.Context, db *sql.DB, id, role string, active bool) error {
 	_, err := db.ExecContext(ctx, `UPDATE users SET role=$1, is_active=$2, updated_at=NOW() WHERE id=$3`, role, active, id)
 	return err
@@ -68,6 +103,140 @@ func SetUserSlackID(ctx context.Context, db *sql.DB, id, slackID string) error {
 	return err
 }
 
+// LinkUserSlackID binds the Slack ID only if the user has not bound one yet (false if already bound)
+func LinkUserSlackID(ctx context.Context, db *sql.DB, id, slackID string) (bool, error) {
+	res, err := db.ExecContext(ctx, `UPDATE users SET slack_id=$1, updated_at=NOW() WHERE id=$2 AND (slack_id IS NULL OR slack_id='')`, slackID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ClearUserSlackID unbinds the user's Slack account
+func ClearUserSlackID(ctx context.Context, db *sql.DB, id string) error {
+	_, err := db.ExecContext(ctx, `UPDATE users SET slack_id=NULL, updated_at=NOW() WHERE id=$1`, id)
+	return err
+}
+
+// Slack bind requests
+func SaveSlackBindRequest(ctx context.Context, db *sql.DB, userID, slackID string, codeHash []byte, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO slack_bind_requests (user_id, slack_id, code_hash, attempts, expires_at, created_at)
+	VALUES ($1, $2, $3, 0, $4, NOW())
+	ON CONFLICT (user_id) DO UPDATE SET
+		slack_id = EXCLUDED.slack_id,
+		code_hash = EXCLUDED.code_hash,
+		attempts = 0,
+		expires_at = EXCLUDED.expires_at,
+		created_at = NOW()`,
+		userID, slackID, codeHash, expiresAt)
+	return err
+}
+
+// GetSlackBindRequest returns the user's pending request (sql.ErrNoRows if none or expired)
+func GetSlackBindRequest(ctx context.Context, db *sql.DB, userID string) (*SlackBindRequest, error) {
+	b := &SlackBindRequest{}
+	err := db.QueryRowContext(ctx, `SELECT user_id,slack_id,code_hash,attempts,expires_at,created_at FROM slack_bind_requests WHERE user_id=$1 AND expires_at > NOW()`, userID).
+		Scan(&b.UserID, &b.SlackID, &b.CodeHash, &b.Attempts, &b.ExpiresAt, &b.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// AddSlackBindAttempt counts a verification attempt and returns the total (sql.ErrNoRows if none or expired)
+func AddSlackBindAttempt(ctx context.Context, db *sql.DB, userID string) (int, error) {
+	var attempts int
+	err := db.QueryRowContext(ctx, `UPDATE slack_bind_requests SET attempts = attempts + 1 WHERE user_id=$1 AND expires_at > NOW() RETURNING attempts`, userID).Scan(&attempts)
+	return attempts, err
+}
+
+func DeleteSlackBindRequest(ctx context.Context, db *sql.DB, userID string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM slack_bind_requests WHERE user_id=$1`, userID)
+	return err
+}
+
+func DeleteExpiredSlackBindRequests(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM slack_bind_requests WHERE expires_at <= NOW()`)
+	return err
+}
+
+// Slack bind throttles（申請間隔と失敗回数の制限。scope ごとに key を数える）
+const (
+	SlackBindScopeUser    = "user"
+	SlackBindScopeSlackID = "slack_id"
+)
+
+// TouchSlackBindThrottle records a new verification request for the key unless it
+// requested one within interval or is locked out. It returns how long to wait when
+// the request is refused (0 if recorded).
+func TouchSlackBindThrottle(ctx context.Context, db *sql.DB, scope, key string, interval time.Duration) (time.Duration, error) {
+	err := db.QueryRowContext(ctx, `
+	INSERT INTO slack_bind_throttles (scope, key, last_requested_at) VALUES ($1, $2, NOW())
+	ON CONFLICT (scope, key) DO UPDATE SET last_requested_at = NOW()
+	WHERE (slack_bind_throttles.last_requested_at IS NULL OR slack_bind_throttles.last_requested_at <= NOW() - make_interval(secs => $3))
+		AND (slack_bind_throttles.locked_until IS NULL OR slack_bind_throttles.locked_until <= NOW())
+	RETURNING scope`, scope, key, interval.Seconds()).Scan(&scope)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	var wait float64
+	err = db.QueryRowContext(ctx, `
+	SELECT EXTRACT(EPOCH FROM GREATEST(
+		COALESCE(last_requested_at + make_interval(secs => $3), NOW()),
+		COALESCE(locked_until, NOW())) - NOW())
+	FROM slack_bind_throttles WHERE scope=$1 AND key=$2`, scope, key, interval.Seconds()).Scan(&wait)
+	if err != nil {
+		return 0, err
+	}
+	// 判定と取得の間に解除された場合も拒否したことに変わりはないため、最低1秒待たせる
+	return max(time.Duration(wait*float64(time.Second)), time.Second), nil
+}
+
+// SlackBindLockedFor returns how long the key stays locked out (0 if not locked)
+func SlackBindLockedFor(ctx context.Context, db *sql.DB, scope, key string) (time.Duration, error) {
+	var wait float64
+	err := db.QueryRowContext(ctx, `
+	SELECT EXTRACT(EPOCH FROM locked_until - NOW()) FROM slack_bind_throttles
+	WHERE scope=$1 AND key=$2 AND locked_until > NOW()`, scope, key).Scan(&wait)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait * float64(time.Second)), nil
+}
+
+// AddSlackBindFailure counts a wrong verification code. Failures older than window
+// are forgotten; reaching maxFailures locks the key out for window.
+func AddSlackBindFailure(ctx context.Context, db *sql.DB, scope, key string, maxFailures int, window time.Duration) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO slack_bind_throttles (scope, key, failures, last_failed_at) VALUES ($1, $2, 1, NOW())
+	ON CONFLICT (scope, key) DO UPDATE SET
+		failures = CASE WHEN slack_bind_throttles.last_failed_at > NOW() - make_interval(secs => $4)
+			THEN slack_bind_throttles.failures + 1 ELSE 1 END,
+		last_failed_at = NOW()`, scope, key, maxFailures, window.Seconds())
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+	UPDATE slack_bind_throttles SET failures = 0, locked_until = NOW() + make_interval(secs => $4)
+	WHERE scope=$1 AND key=$2 AND failures >= $3`, scope, key, maxFailures, window.Seconds())
+	return err
+}
+
+// ClearSlackBindFailures forgets the key's failures after a successful verification
+func ClearSlackBindFailures(ctx context.Context, db *sql.DB, scope, key string) error {
+	_, err := db.ExecContext(ctx, `UPDATE slack_bind_throttles SET failures = 0, last_failed_at = NULL WHERE scope=$1 AND key=$2`, scope, key)
+	return err
+}
+
 // Sessions
 func CreateSession(ctx context.Context, db *sql.DB, userID string, tokenHash []byte, expiresAt time.Time) (string, error) {
 	var id string
@@ -92,7 +261,7 @@ func DeleteSessionByHash(ctx context.Context, db *sql.DB, tokenHash []byte) erro
 
 // Admin: list users
 func ListUsers(ctx context.Context, db *sql.DB) ([]UserRow, error) {
-	rows, err := db.QueryContext(ctx, `SELECT id,name,email,slack_id,role,is_active,created_at FROM users ORDER BY created_at DESC`)
+	rows, err := db.QueryContext(ctx, `SELECT id,name,email,slack_id,role,COALESCE(org_id,0),is_active,created_at FROM users ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +269,7 @@ func ListUsers(ctx context.Context, db *sql.DB) ([]UserRow, error) {
 	var out []UserRow
 	for rows.Next() {
 		var r UserRow
-		if err := rows.Scan(&r.ID, &r.Name, &r.Email, &r.SlackID, &r.Role, &r.IsActive, &r.CreatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.Email, &r.SlackID, &r.Role, &r.OrgID, &r.IsActive, &r.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, r)
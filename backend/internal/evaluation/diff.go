@@ -0,0 +1,132 @@
+package evaluation
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// changeThreshold 未満の差は変化なしとみなす
+const changeThreshold = 1e-6
+
+// CaseDiff は前回実行からの1問分の変化
+type CaseDiff struct {
+	ID                  string
+	Question            string
+	RecallDelta         float64
+	ReciprocalRankDelta float64
+	OverlapDelta        float64
+	// Status は "new"（前回なし）、"removed"（今回なし）、"changed" のいずれか
+	Status string
+}
+
+// Diff は前回実行との比較結果
+type Diff struct {
+	RecallDelta  float64
+	MRRDelta     float64
+	OverlapDelta float64
+	Cases        []CaseDiff
+}
+
+// Compare は前回と今回の評価結果を比較する
+func Compare(prev, cur *Report) *Diff {
+	d := &Diff{
+		RecallDelta:  cur.Summary.RecallAtK - prev.Summary.RecallAtK,
+		MRRDelta:     cur.Summary.MRR - prev.Summary.MRR,
+		OverlapDelta: cur.Summary.AnswerOverlap - prev.Summary.AnswerOverlap,
+	}
+
+	before := map[string]CaseResult{}
+	for _, r := range prev.Results {
+		before[r.ID] = r
+	}
+
+	for _, r := range cur.Results {
+		p, ok := before[r.ID]
+		delete(before, r.ID)
+		if !ok {
+			d.Cases = append(d.Cases, CaseDiff{ID: r.ID, Question: r.Question, Status: "new"})
+			continue
+		}
+
+		cd := CaseDiff{
+			ID:                  r.ID,
+			Question:            r.Question,
+			RecallDelta:         r.RecallAtK - p.RecallAtK,
+			ReciprocalRankDelta: r.ReciprocalRank - p.ReciprocalRank,
+			OverlapDelta:        overlapValue(r) - overlapValue(p),
+			Status:              "changed",
+		}
+		if changed(cd.RecallDelta) || changed(cd.ReciprocalRankDelta) || changed(cd.OverlapDelta) {
+			d.Cases = append(d.Cases, cd)
+		}
+	}
+
+	for id, p := range before {
+		d.Cases = append(d.Cases, CaseDiff{ID: id, Question: p.Question, Status: "removed"})
+	}
+
+	sort.Slice(d.Cases, func(i, j int) bool { return d.Cases[i].ID < d.Cases[j].ID })
+	return d
+}
+
+// PrintReport は評価結果を表形式で出力する
+func PrintReport(w io.Writer, r *Report) {
+	fmt.Fprintf(w, "Provider: %s  k=%d  cases=%d\n\n", r.Provider, r.K, r.Summary.Cases)
+	for _, c := range r.Results {
+		if c.Error != "" {
+			fmt.Fprintf(w, "  %-24s ERROR: %s\n", c.ID, c.Error)
+			continue
+		}
+		overlap := "-"
+		if c.AnswerOverlap != nil {
+			overlap = fmt.Sprintf("%.3f", *c.AnswerOverlap)
+		}
+		fmt.Fprintf(w, "  %-24s recall@%d=%.3f  rr=%.3f  overlap=%s  retrieved=%v\n",
+			c.ID, r.K, c.RecallAtK, c.ReciprocalRank, overlap, c.RetrievedIDs)
+	}
+	fmt.Fprintf(w, "\nrecall@%d: %.4f\nMRR:       %.4f\noverlap:   %.4f (%d cases with reference answers)\n",
+		r.K, r.Summary.RecallAtK, r.Summary.MRR, r.Summary.AnswerOverlap, r.Summary.AnswerCases)
+}
+
+// PrintDiff は前回からの変化を出力する
+func PrintDiff(w io.Writer, d *Diff) {
+	fmt.Fprintf(w, "\nChange since previous run:\n")
+	fmt.Fprintf(w, "  recall@k %+.4f  MRR %+.4f  overlap %+.4f\n", d.RecallDelta, d.MRRDelta, d.OverlapDelta)
+	if len(d.Cases) == 0 {
+		fmt.Fprintln(w, "  no per-case changes")
+		return
+	}
+	for _, c := range d.Cases {
+		switch c.Status {
+		case "new", "removed":
+			fmt.Fprintf(w, "  [%s] %s: %s\n", c.Status, c.ID, c.Question)
+		default:
+			fmt.Fprintf(w, "  %s %s: recall %+.3f  rr %+.3f  overlap %+.3f\n",
+				trend(c.RecallDelta+c.ReciprocalRankDelta+c.OverlapDelta), c.ID, c.RecallDelta, c.ReciprocalRankDelta, c.OverlapDelta)
+		}
+	}
+}
+
+func overlapValue(r CaseResult) float64 {
+	if r.AnswerOverlap == nil {
+		return 0
+	}
+	return *r.AnswerOverlap
+}
+
+func changed(delta float64) bool {
+	return math.Abs(delta) > changeThreshold
+}
+
+func trend(delta float64) string {
+	switch {
+	case delta > changeThreshold:
+		return "▲"
+	case delta < -changeThreshold:
+		return "▼"
+	default:
+		return "="
+	}
+}
@@ -0,0 +1,156 @@
+// Package evaluation は検索・回答生成の品質をゴールデンセットでオフライン評価する
+package evaluation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"slack-bot/backend/internal/knowledge"
+)
+
+// Case はゴールデンセットの1問
+type Case struct {
+	ID              string `json:"id"`
+	Question        string `json:"question"`
+	ExpectedIDs     []int  `json:"expected_ids"`
+	ReferenceAnswer string `json:"reference_answer,omitempty"`
+}
+
+// CaseResult は1問分の評価結果
+type CaseResult struct {
+	ID           string  `json:"id"`
+	Question     string  `json:"question"`
+	RetrievedIDs []int   `json:"retrieved_ids"`
+	RecallAtK    float64 `json:"recall_at_k"`
+	// ReciprocalRank は最初に正解が現れた順位の逆数（見つからなければ 0）
+	ReciprocalRank float64 `json:"reciprocal_rank"`
+	// AnswerOverlap は参照回答との n-gram F1（参照回答がない場合は nil）
+	AnswerOverlap *float64 `json:"answer_overlap,omitempty"`
+	Answer        string   `json:"answer"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// Summary は全問の平均
+type Summary struct {
+	Cases         int     `json:"cases"`
+	RecallAtK     float64 `json:"recall_at_k"`
+	MRR           float64 `json:"mrr"`
+	AnswerOverlap float64 `json:"answer_overlap"`
+	// AnswerCases は参照回答があり AnswerOverlap の対象になった問数
+	AnswerCases int `json:"answer_cases"`
+}
+
+// Report は1回の評価実行の結果
+type Report struct {
+	RunAt    time.Time    `json:"run_at"`
+	Provider string       `json:"provider"`
+	K        int          `json:"k"`
+	Summary  Summary      `json:"summary"`
+	Results  []CaseResult `json:"results"`
+}
+
+// LoadGoldenSet は JSON 配列形式のゴールデンセットを読み込む
+func LoadGoldenSet(path string) ([]Case, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	if err := json.Unmarshal(b, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse golden set: %w", err)
+	}
+
+	for i, c := range cases {
+		if strings.TrimSpace(c.Question) == "" {
+			return nil, fmt.Errorf("case %d: question is required", i)
+		}
+		if c.ID == "" {
+			cases[i].ID = fmt.Sprintf("case-%d", i+1)
+		}
+	}
+	return cases, nil
+}
+
+// LoadReport は以前の評価結果を読み込む
+func LoadReport(path string) (*Report, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %w", err)
+	}
+	return &r, nil
+}
+
+// Save は評価結果を JSON で保存する
+func (r *Report) Save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Run は各問をナレッジサービスに問い合わせて評価する
+func Run(ctx context.Context, svc knowledge.Service, cases []Case, k int, provider string) *Report {
+	report := &Report{
+		RunAt:    time.Now(),
+		Provider: provider,
+		K:        k,
+	}
+
+	for _, c := range cases {
+		result := CaseResult{ID: c.ID, Question: c.Question}
+
+		res, err := svc.Ask(ctx, knowledge.AskRequest{Question: c.Question, DryRun: true})
+		if err != nil {
+			result.Error = err.Error()
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		for _, r := range res.Related {
+			result.RetrievedIDs = append(result.RetrievedIDs, r.ID)
+		}
+		result.Answer = res.Answer
+		result.RecallAtK = RecallAtK(c.ExpectedIDs, result.RetrievedIDs, k)
+		result.ReciprocalRank = ReciprocalRank(c.ExpectedIDs, result.RetrievedIDs)
+		if c.ReferenceAnswer != "" {
+			overlap := AnswerOverlap(res.Answer, c.ReferenceAnswer)
+			result.AnswerOverlap = &overlap
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	report.Summary = summarize(report.Results)
+	return report
+}
+
+func summarize(results []CaseResult) Summary {
+	s := Summary{Cases: len(results)}
+	if len(results) == 0 {
+		return s
+	}
+	for _, r := range results {
+		s.RecallAtK += r.RecallAtK
+		s.MRR += r.ReciprocalRank
+		if r.AnswerOverlap != nil {
+			s.AnswerOverlap += *r.AnswerOverlap
+			s.AnswerCases++
+		}
+	}
+	s.RecallAtK /= float64(len(results))
+	s.MRR /= float64(len(results))
+	if s.AnswerCases > 0 {
+		s.AnswerOverlap /= float64(s.AnswerCases)
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package evaluation
+
+import (
+	"strings"
+
+	"slack-bot/backend/internal/knowledge"
+)
+
+// RecallAtK は上位 k 件に含まれた正解IDの割合を返す（正解が空なら 1）
+func RecallAtK(expected, retrieved []int, k int) float64 {
+	if len(expected) == 0 {
+		return 1
+	}
+	if k > len(retrieved) {
+		k = len(retrieved)
+	}
+
+	top := map[int]bool{}
+	for _, id := range retrieved[:k] {
+		top[id] = true
+	}
+
+	hit := 0
+	for _, id := range expected {
+		if top[id] {
+			hit++
+		}
+	}
+	return float64(hit) / float64(len(expected))
+}
+
+// ReciprocalRank は最初に正解が現れた順位の逆数を返す
+func ReciprocalRank(expected, retrieved []int) float64 {
+	want := map[int]bool{}
+	for _, id := range expected {
+		want[id] = true
+	}
+	for i, id := range retrieved {
+		if want[id] {
+			return 1 / float64(i+1)
+		}
+	}
+	return 0
+}
+
+// AnswerOverlap は回答と参照回答の n-gram トークン（全文検索と同じ分割）の F1 を返す
+func AnswerOverlap(answer, reference string) float64 {
+	got := tokenCounts(answer)
+	want := tokenCounts(reference)
+	if len(got) == 0 || len(want) == 0 {
+		return 0
+	}
+
+	common, gotTotal, wantTotal := 0, 0, 0
+	for t, n := range got {
+		gotTotal += n
+		if m := want[t]; m > 0 {
+			common += min(n, m)
+		}
+	}
+	for _, n := range want {
+		wantTotal += n
+	}
+	if common == 0 {
+		return 0
+	}
+
+	precision := float64(common) / float64(gotTotal)
+	recall := float64(common) / float64(wantTotal)
+	return 2 * precision * recall / (precision + recall)
+}
+
+func tokenCounts(text string) map[string]int {
+	counts := map[string]int{}
+	for _, t := range strings.Fields(knowledge.IndexTokens(text)) {
+		// uni-gram は一致しやすすぎるため bi-gram と単語のみで比較する
+		if len([]rune(t)) < 2 {
+			continue
+		}
+		counts[t]++
+	}
+	return counts
+}
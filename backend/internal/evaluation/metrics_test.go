@@ -0,0 +1,77 @@
+package evaluation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRecallAtK(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  []int
+		retrieved []int
+		k         int
+		want      float64
+	}{
+		{"all expected in top k", []int{1, 2}, []int{2, 1, 3}, 2, 1},
+		{"one of two in top k", []int{1, 2}, []int{1, 3, 2}, 2, 0.5},
+		{"expected below k", []int{3}, []int{1, 2, 3}, 2, 0},
+		{"k larger than retrieved", []int{1, 2}, []int{2}, 5, 0.5},
+		{"nothing retrieved", []int{1}, nil, 3, 0},
+		{"no expected ids", nil, []int{1, 2}, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RecallAtK(tt.expected, tt.retrieved, tt.k); got != tt.want {
+				t.Errorf("RecallAtK(%v, %v, %d) = %v, want %v", tt.expected, tt.retrieved, tt.k, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReciprocalRank(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  []int
+		retrieved []int
+		want      float64
+	}{
+		{"first", []int{1}, []int{1, 2, 3}, 1},
+		{"third", []int{3}, []int{1, 2, 3}, 1.0 / 3},
+		{"earliest of several expected", []int{3, 2}, []int{1, 2, 3}, 0.5},
+		{"not retrieved", []int{4}, []int{1, 2, 3}, 0},
+		{"nothing retrieved", []int{1}, nil, 0},
+		{"no expected ids", nil, []int{1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReciprocalRank(tt.expected, tt.retrieved); got != tt.want {
+				t.Errorf("ReciprocalRank(%v, %v) = %v, want %v", tt.expected, tt.retrieved, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnswerOverlap(t *testing.T) {
+	tests := []struct {
+		name      string
+		answer    string
+		reference string
+		want      float64
+	}{
+		{"identical", "経費精算は月末締め", "経費精算は月末締め", 1},
+		{"normalized latin matches", "ＶＰＮ", "vpn", 1},
+		{"partial overlap", "東京都", "東京", 2.0 / 3},
+		{"disjoint", "東京", "大阪", 0},
+		{"unigrams are ignored", "炎", "炎", 0},
+		{"empty answer", "", "経費精算", 0},
+		{"empty reference", "経費精算", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnswerOverlap(tt.answer, tt.reference); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("AnswerOverlap(%q, %q) = %v, want %v", tt.answer, tt.reference, got, tt.want)
+			}
+		})
+	}
+}
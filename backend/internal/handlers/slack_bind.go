@@ -1,17 +1,56 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"log"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
 	"slack-bot/backend/internal/app"
 	"slack-bot/backend/internal/auth"
+	cryptopkg "slack-bot/backend/internal/crypto"
 	dbpkg "slack-bot/backend/internal/db"
+	slackbot "slack-bot/backend/internal/slack"
 )
 
+// 確認コードの設定
+const (
+	bindCodeDigits = 6
+	bindCodeTTL    = 10 * time.Minute
+	// bindMaxAttempts 回間違えると申請を取り消し、最初からやり直してもらう
+	bindMaxAttempts = 5
+	// bindResendInterval 以内の再申請は DM の連投を防ぐため拒否する（ユーザーごと・送信先の Slack アカウントごと）
+	bindResendInterval = time.Minute
+	// 申請をやり直しても bindLockout 以内に bindMaxFailures 回間違えると、bindLockout の間は申請・入力を拒否する
+	bindMaxFailures = 10
+	bindLockout     = time.Hour
+)
+
+// bindThrottleKey は申請間隔と失敗回数を数える単位
+type bindThrottleKey struct {
+	scope, key string
+}
+
+// bindThrottleKeys は Web アプリのユーザーと送信先の Slack アカウントの両方で数える
+func bindThrottleKeys(uid, slackID string) []bindThrottleKey {
+	return []bindThrottleKey{{dbpkg.SlackBindScopeUser, uid}, {dbpkg.SlackBindScopeSlackID, slackID}}
+}
+
+// tooManyRequests は Retry-After を付けて 429 を返す
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, msg string) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+	http.Error(w, msg, 429)
+}
+
+// slackIDPattern は Slack のメンバーID（U… / W…）
+var slackIDPattern = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
+
 type slackStartReq struct {
 	SlackID string `json:"slack_id"`
 }
@@ -20,60 +59,239 @@ type slackVerifyReq struct {
 	Code string `json:"code"`
 }
 
-// 簡易: DB テーブルを使わず、コードをメモリ or TODO: slack_bind_requests に保存する実装に差し替え
-var codeMem = map[string]string{} // userID -> code (雛形用)
-
+// PostSlackStart は未連携のユーザーの連携を開始し、入力された Slack アカウントに確認コードをDMする
 func PostSlackStart(a *app.App) http.HandlerFunc {
+	return startSlackBind(a, false)
+}
+
+// PostSlackRebind は連携済みのユーザーが別の Slack アカウントに連携し直す。
+// 新しいアカウントの確認が済むまでは現在の連携を維持する
+func PostSlackRebind(a *app.App) http.HandlerFunc {
+	return startSlackBind(a, true)
+}
+
+func startSlackBind(a *app.App, rebind bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", 405)
+			return
+		}
 		uid := auth.CurrentUserID(r)
 		if uid == "" {
 			http.Error(w, "unauthorized", 401)
 			return
 		}
 		var req slackStartReq
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SlackID == "" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "bad request", 400)
 			return
 		}
-		// 6 桁コード作成
-		rand.Seed(time.Now().UnixNano())
-		code := rand.Intn(900000) + 100000
-		codeMem[uid] = fmt.Sprintf("%06d", code)
+		slackID := strings.ToUpper(strings.TrimSpace(req.SlackID))
+		if !slackIDPattern.MatchString(slackID) {
+			http.Error(w, "invalid slack_id", 400)
+			return
+		}
+
+		ctx := r.Context()
+		user, err := dbpkg.GetUserByID(ctx, a.DB, uid)
+		if err != nil {
+			log.Printf("Failed to load user %s: %v", uid, err)
+			http.Error(w, "internal error", 500)
+			return
+		}
+		bound := user.SlackID.Valid && user.SlackID.String != ""
+		switch {
+		case bound && !rebind:
+			http.Error(w, "slack account already bound (use rebind)", 409)
+			return
+		case !bound && rebind:
+			http.Error(w, "slack account not bound (use start)", 400)
+			return
+		case bound && user.SlackID.String == slackID:
+			http.Error(w, "slack account already bound to this user", 409)
+			return
+		}
+
+		// 他のユーザーが連携済みの Slack アカウントには確認コードを送らない
+		if other, err := dbpkg.GetUserBySlackID(ctx, a.DB, slackID); err == nil && other.ID != uid {
+			http.Error(w, "slack account is bound to another user", 409)
+			return
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up slack_id %s: %v", slackID, err)
+			http.Error(w, "internal error", 500)
+			return
+		}
 
-		// TODO: Slack DM 送信（現状はログ代替）
-		// slackbot.SendDM(req.SlackID, fmt.Sprintf("Your verification code: %06d", code))
+		if err := dbpkg.DeleteExpiredSlackBindRequests(ctx, a.DB); err != nil {
+			a.LogErr(err)
+		}
+		// 前回の申請が取り消し・期限切れでも、最後に申請した時刻から間隔を空けさせる
+		var wait time.Duration
+		for _, t := range bindThrottleKeys(uid, slackID) {
+			d, err := dbpkg.TouchSlackBindThrottle(ctx, a.DB, t.scope, t.key, bindResendInterval)
+			if err != nil {
+				log.Printf("Failed to check slack bind throttle for %s %s: %v", t.scope, t.key, err)
+				http.Error(w, "internal error", 500)
+				return
+			}
+			wait = max(wait, d)
+		}
+		if wait > 0 {
+			tooManyRequests(w, wait, "verification code was requested recently or too many failed attempts")
+			return
+		}
+
+		code, hash, err := cryptopkg.NewCode(bindCodeDigits)
+		if err != nil {
+			log.Printf("Failed to generate verification code: %v", err)
+			http.Error(w, "internal error", 500)
+			return
+		}
+		expiresAt := time.Now().Add(bindCodeTTL)
+		if err := dbpkg.SaveSlackBindRequest(ctx, a.DB, uid, slackID, hash, expiresAt); err != nil {
+			log.Printf("Failed to save slack bind request for %s: %v", uid, err)
+			http.Error(w, "internal error", 500)
+			return
+		}
 
-		auth.JSON(w, 200, map[string]any{"requires_verification": true})
+		msg := fmt.Sprintf("Slack アカウント連携の確認コード: *%s*\n%d分以内に Web アプリで入力してください。心当たりがない場合はこのメッセージを無視してください。", code, int(bindCodeTTL.Minutes()))
+		// 確認コードはユーザーの組織のワークスペースの Bot から送る
+		if err := slackbot.SendDM(ctx, user.OrgID, slackID, msg); err != nil {
+			if err := dbpkg.DeleteSlackBindRequest(ctx, a.DB, uid); err != nil {
+				a.LogErr(err)
+			}
+			if errors.Is(err, slackbot.ErrNotInstalled) {
+				http.Error(w, "slack app is not installed for this organization", 503)
+				return
+			}
+			log.Printf("Failed to send verification code to %s: %v", slackID, err)
+			http.Error(w, "failed to send verification code", 502)
+			return
+		}
+
+		auth.JSON(w, 200, map[string]any{"requires_verification": true, "expires_at": expiresAt})
 	}
 }
 
+// PostSlackVerify は確認コードを照合し、申請時の Slack アカウントを連携する
 func PostSlackVerify(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", 405)
+			return
+		}
 		uid := auth.CurrentUserID(r)
 		if uid == "" {
 			http.Error(w, "unauthorized", 401)
 			return
 		}
 		var req slackVerifyReq
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
 			http.Error(w, "bad request", 400)
 			return
 		}
-		if codeMem[uid] != req.Code {
-			http.Error(w, "invalid code", 401)
+
+		ctx := r.Context()
+		pending, err := dbpkg.GetSlackBindRequest(ctx, a.DB, uid)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "no pending verification (expired or not started)", 400)
 			return
 		}
-		// TODO: SlackID は start 時に persist（雛形簡略化のため固定値）
-		// 実装時は slack_bind_requests に (uid, slack_id, code) を保存 → ここで取り出す
-		slackID := r.URL.Query().Get("slack_id") // 雛形用
-		if slackID == "" {
-			slackID = "U123PLACEHOLDER"
+		if err != nil {
+			log.Printf("Failed to load slack bind request for %s: %v", uid, err)
+			http.Error(w, "internal error", 500)
+			return
 		}
-		if err := dbpkg.SetUserSlackID(r.Context(), a.DB, uid, slackID); err != nil {
-			http.Error(w, err.Error(), 500)
+
+		for _, t := range bindThrottleKeys(uid, pending.SlackID) {
+			locked, err := dbpkg.SlackBindLockedFor(ctx, a.DB, t.scope, t.key)
+			if err != nil {
+				log.Printf("Failed to check slack bind lockout for %s %s: %v", t.scope, t.key, err)
+				http.Error(w, "internal error", 500)
+				return
+			}
+			if locked > 0 {
+				tooManyRequests(w, locked, "too many failed attempts, try again later")
+				return
+			}
+		}
+
+		// 照合前に試行回数を数え、並行したリクエストでも上限を超えて試せないようにする
+		attempts, err := dbpkg.AddSlackBindAttempt(ctx, a.DB, uid)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "no pending verification (expired or not started)", 400)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to count slack bind attempt for %s: %v", uid, err)
+			http.Error(w, "internal error", 500)
+			return
+		}
+		if attempts > bindMaxAttempts {
+			if err := dbpkg.DeleteSlackBindRequest(ctx, a.DB, uid); err != nil {
+				a.LogErr(err)
+			}
+			http.Error(w, "too many attempts, start again", 429)
+			return
+		}
+		if subtle.ConstantTimeCompare(cryptopkg.Hash(strings.TrimSpace(req.Code)), pending.CodeHash) != 1 {
+			// 申請をやり直しても失敗回数が残るよう、ユーザーと送信先ごとに記録する
+			for _, t := range bindThrottleKeys(uid, pending.SlackID) {
+				if err := dbpkg.AddSlackBindFailure(ctx, a.DB, t.scope, t.key, bindMaxFailures, bindLockout); err != nil {
+					a.LogErr(err)
+				}
+			}
+			if attempts == bindMaxAttempts {
+				if err := dbpkg.DeleteSlackBindRequest(ctx, a.DB, uid); err != nil {
+					a.LogErr(err)
+				}
+			}
+			auth.JSON(w, 401, map[string]any{"error": "invalid code", "remaining_attempts": bindMaxAttempts - attempts})
+			return
+		}
+
+		if other, err := dbpkg.GetUserBySlackID(ctx, a.DB, pending.SlackID); err == nil && other.ID != uid {
+			http.Error(w, "slack account is bound to another user", 409)
 			return
 		}
-		delete(codeMem, uid)
-		auth.JSON(w, 200, map[string]any{"ok": true, "slack_id": slackID})
+		if err := dbpkg.SetUserSlackID(ctx, a.DB, uid, pending.SlackID); err != nil {
+			log.Printf("Failed to bind slack_id for %s: %v", uid, err)
+			http.Error(w, "internal error", 500)
+			return
+		}
+		if err := dbpkg.DeleteSlackBindRequest(ctx, a.DB, uid); err != nil {
+			a.LogErr(err)
+		}
+		for _, t := range bindThrottleKeys(uid, pending.SlackID) {
+			if err := dbpkg.ClearSlackBindFailures(ctx, a.DB, t.scope, t.key); err != nil {
+				a.LogErr(err)
+			}
+		}
+		auth.JSON(w, 200, map[string]any{"ok": true, "slack_id": pending.SlackID})
+	}
+}
+
+// PostSlackUnbind は Slack アカウントの連携と進行中の申請を解除する
+func PostSlackUnbind(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", 405)
+			return
+		}
+		uid := auth.CurrentUserID(r)
+		if uid == "" {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		ctx := r.Context()
+		if err := dbpkg.ClearUserSlackID(ctx, a.DB, uid); err != nil {
+			log.Printf("Failed to unbind slack_id for %s: %v", uid, err)
+			http.Error(w, "internal error", 500)
+			return
+		}
+		if err := dbpkg.DeleteSlackBindRequest(ctx, a.DB, uid); err != nil {
+			a.LogErr(err)
+		}
+		auth.JSON(w, 200, map[string]any{"ok": true})
 	}
 }
@@ -0,0 +1,183 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"slack-bot/backend/internal/ai"
+	"slack-bot/backend/internal/security"
+)
+
+// askSearchLimit は回答生成の根拠として検索するナレッジの件数
+const askSearchLimit = 10
+
+// AskRequest は質問応答のリクエスト
+type AskRequest struct {
+	Question string `json:"question"`
+	// OrgID は質問者の組織（組織ごとの伏せ字ルールなどに使う。0 は未指定）。
+	// OrgID・AskedBy はリクエストボディからは受け付けず、呼び出し元が設定する
+	OrgID int64 `json:"-"`
+	// AskedBy は質問者の Slack ユーザーID。ナレッジ不足レポートの人数集計と App Home の最近の質問に使う
+	AskedBy string `json:"-"`
+	// DryRun は回答キャッシュ・質問履歴・ナレッジ不足レポートを読み書きせずに回答する（評価用）
+	DryRun bool `json:"-"`
+}
+
+// AskResult は質問応答の結果
+type AskResult struct {
+	Answer     string      `json:"answer"`
+	Related    []Knowledge `json:"related"`
+	FoundCount int         `json:"found_count"`
+	// Suspicious は質問または根拠のナレッジにプロンプトインジェクションの疑いがあることを示す
+	Suspicious     bool     `json:"suspicious"`
+	InjectionFlags []string `json:"injection_flags,omitempty"`
+	// Cached は過去の類似質問に対する回答を再利用したことを示す
+	Cached bool `json:"cached,omitempty"`
+	// Unanswered は関連ナレッジが見つからない、またはナレッジから回答できなかったことを示す
+	Unanswered bool `json:"unanswered,omitempty"`
+}
+
+// Ask searches related knowledge and generates an answer grounded in it
+func (s *service) Ask(ctx context.Context, req AskRequest) (*AskResult, error) {
+	log.Printf("Processing question: %s", req.Question)
+
+	// 以降の外部AI呼び出しはすべて組織の伏せ字ルールを適用する
+	ctx = s.withRedaction(ctx, req.OrgID)
+
+	// 0. 質問そのもののインジェクション検出
+	flags := security.DetectPromptInjection(req.Question)
+
+	// 1. 質問のEmbeddingを生成し、類似の質問への回答がキャッシュにあれば再利用する
+	embedding, err := ai.GenerateEmbedding(ctx, req.Question)
+	if err != nil {
+		log.Printf("Embedding failed, falling back to text search: %v", err)
+		embedding = nil
+	}
+	useCache := s.answerCacheEnabled() && embedding != nil && len(flags) == 0 && !req.DryRun
+	if useCache {
+		if cached := s.cachedAsk(req.OrgID, embedding); cached != nil {
+			s.recordAsk(req, cached, true)
+			return cached, nil
+		}
+	}
+
+	// 2. 類似ナレッジ検索
+	results, err := s.search(req.Question, embedding, askSearchLimit)
+	if err != nil {
+		log.Printf("Search failed: %v", err)
+		// エラーの場合でも基本的な回答を返す
+		return &AskResult{
+			Answer:  "申し訳ございませんが、現在ナレッジベースにアクセスできません。しばらく後で再試行してください。",
+			Related: []Knowledge{},
+		}, nil
+	}
+
+	log.Printf("Found %d similar knowledge items", len(results))
+
+	// 3. 検索結果を根拠ドキュメントとして整理（ナレッジベース情報のみ）
+	docs := make([]ai.Document, 0, len(results))
+	for _, k := range results {
+		// 保存時の検出結果に加え、検出ルール追加前に保存されたものも再検査する
+		flags = appendFlags(flags, k.InjectionFlags...)
+		flags = appendFlags(flags, security.DetectPromptInjection(k.Title+"\n"+k.Content)...)
+
+		// 要約があれば優先し、なければ200文字制限を考慮してコンテンツを簡潔に
+		content := k.Content
+		if k.Summary != "" {
+			content = k.Summary
+		} else if len([]rune(content)) > 150 {
+			runes := []rune(content)
+			content = string(runes[:147]) + "..."
+		}
+		docs = append(docs, ai.Document{ID: k.ID, Title: k.Title, Content: content})
+	}
+
+	if len(flags) > 0 {
+		security.LogSecurityEvent("prompt_injection_suspected", map[string]interface{}{
+			"question": req.Question,
+			"flags":    flags,
+		})
+	}
+
+	// 伏せ字にした情報は回答で復元されるため、伏せ字が発生する回答は他の質問者に使い回さない
+	if useCache {
+		texts := []string{req.Question}
+		for _, d := range docs {
+			texts = append(texts, d.Title, d.Content)
+		}
+		if n := ai.CountRedactions(ctx, texts...); n > 0 {
+			log.Printf("Not caching answer: %d item(s) redacted", n)
+			useCache = false
+		}
+	}
+
+	// 4. OpenAI GPTで回答生成
+	answer, err := ai.GenerateAnswer(ctx, req.Question, docs)
+	if err != nil {
+		useCache = false
+		log.Printf("GPT error: %v", err)
+		// GPTエラーの場合はシンプルな回答を返す（200文字制限適用）
+		if len(results) > 0 {
+			answer = fmt.Sprintf("質問「%s」について、登録されたナレッジから以下の情報が見つかりました。詳細については個別にお聞きください。", req.Question)
+		} else {
+			answer = "申し訳ございません。関連するナレッジが見つかりませんでした。別のキーワードで検索するか、新しいナレッジを登録してください。"
+		}
+		// 200文字制限を適用
+		if len([]rune(answer)) > 200 {
+			runes := []rune(answer)
+			answer = string(runes[:197]) + "..."
+		}
+	}
+
+	log.Printf("Generated answer: %s", answer)
+
+	// 回答できなかった質問はナレッジ不足レポートのために記録する
+	gap := ""
+	switch {
+	case len(results) == 0:
+		gap = GapNoResults
+	case strings.Contains(answer, noAnswerPhrase):
+		gap = GapNoAnswer
+	}
+	if gap != "" && !req.DryRun {
+		s.recordUnanswered(req, embedding, gap)
+	}
+
+	result := &AskResult{
+		Answer:         answer,
+		Related:        results,
+		FoundCount:     len(results),
+		Suspicious:     len(flags) > 0,
+		InjectionFlags: flags,
+		Unanswered:     gap != "",
+	}
+
+	// 代替回答・回答できなかった場合・インジェクションの疑いがある回答・伏せ字が発生した回答はキャッシュしない
+	if useCache && len(flags) == 0 && gap == "" {
+		s.storeAnswer(req.OrgID, req.Question, embedding, result)
+	}
+	if !req.DryRun {
+		s.recordAsk(req, result, gap == "")
+	}
+
+	return result, nil
+}
+
+// appendFlags adds flags that are not already present
+func appendFlags(flags []string, more ...string) []string {
+	for _, f := range more {
+		found := false
+		for _, existing := range flags {
+			if existing == f {
+				found = true
+				break
+			}
+		}
+		if !found {
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
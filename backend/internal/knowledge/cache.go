@@ -0,0 +1,163 @@
+package knowledge
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CachedAnswer は過去の質問に対して生成した回答
+type CachedAnswer struct {
+	ID           int64
+	OrgID        int64
+	Question     string
+	Answer       string
+	KnowledgeIDs []int
+	// KnowledgeScores と KnowledgeSimilarities は KnowledgeIDs と同じ順の検索スコアと類似度
+	KnowledgeScores       []float64
+	KnowledgeSimilarities []float64
+	Similarity            float64
+	ExpiresAt             time.Time
+}
+
+// FindCachedAnswer returns the most similar unexpired cached answer of the
+// organization at or above minSimilarity (nil if there is none)
+func (r *repository) FindCachedAnswer(orgID int64, embedding []float32, minSimilarity float64) (*CachedAnswer, error) {
+	vector := fmt.Sprintf("[%s]", float32SliceToString(embedding))
+
+	var c CachedAnswer
+	var ids pq.Int64Array
+	var scores, similarities pq.Float64Array
+	err := r.db.QueryRow(`
+	SELECT id, org_id, question, answer, knowledge_ids, knowledge_scores, knowledge_similarities,
+		1 - (embedding <=> $2) AS similarity, expires_at
+	FROM answer_cache
+	WHERE org_id = $1 AND expires_at > NOW()
+	ORDER BY embedding <=> $2
+	LIMIT 1`, orgID, vector).Scan(&c.ID, &c.OrgID, &c.Question, &c.Answer, &ids, &scores, &similarities, &c.Similarity, &c.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Similarity < minSimilarity {
+		return nil, nil
+	}
+
+	for _, id := range ids {
+		c.KnowledgeIDs = append(c.KnowledgeIDs, int(id))
+	}
+	c.KnowledgeScores = scores
+	c.KnowledgeSimilarities = similarities
+
+	if _, err := r.db.Exec("UPDATE answer_cache SET hit_count = hit_count + 1 WHERE id = $1", c.ID); err != nil {
+		log.Printf("Failed to update answer cache hit count: %v", err)
+	}
+	return &c, nil
+}
+
+// SaveCachedAnswer stores an answer and removes the organization's expired entries
+func (r *repository) SaveCachedAnswer(c CachedAnswer, embedding []float32) error {
+	vector := fmt.Sprintf("[%s]", float32SliceToString(embedding))
+
+	ids := make(pq.Int64Array, 0, len(c.KnowledgeIDs))
+	for _, id := range c.KnowledgeIDs {
+		ids = append(ids, int64(id))
+	}
+
+	if _, err := r.db.Exec("DELETE FROM answer_cache WHERE org_id = $1 AND expires_at <= NOW()", c.OrgID); err != nil {
+		log.Printf("Failed to purge expired answer cache: %v", err)
+	}
+
+	_, err := r.db.Exec(`
+	INSERT INTO answer_cache (org_id, question, embedding, answer, knowledge_ids, knowledge_scores, knowledge_similarities, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		c.OrgID, c.Question, vector, c.Answer, ids,
+		pq.Float64Array(c.KnowledgeScores), pq.Float64Array(c.KnowledgeSimilarities), c.ExpiresAt)
+	return err
+}
+
+// InvalidateCachedAnswers deletes every cached answer that cited one of the given entries
+func (r *repository) InvalidateCachedAnswers(knowledgeIDs ...int) error {
+	ids := make(pq.Int64Array, 0, len(knowledgeIDs))
+	for _, id := range knowledgeIDs {
+		ids = append(ids, int64(id))
+	}
+	_, err := r.db.Exec("DELETE FROM answer_cache WHERE knowledge_ids && $1::INTEGER[]", ids)
+	return err
+}
+
+// answerCacheEnabled reports whether Ask should read and write the answer cache
+func (s *service) answerCacheEnabled() bool {
+	return s.opts.AnswerCacheTTL > 0
+}
+
+// cachedAsk returns the stored answer for a question similar enough to a previous one
+func (s *service) cachedAsk(orgID int64, embedding []float32) *AskResult {
+	cached, err := s.repo.FindCachedAnswer(orgID, embedding, s.opts.AnswerCacheThreshold)
+	if err != nil {
+		log.Printf("Answer cache lookup failed: %v", err)
+		return nil
+	}
+	if cached == nil {
+		return nil
+	}
+
+	related := make([]Knowledge, 0, len(cached.KnowledgeIDs))
+	for i, id := range cached.KnowledgeIDs {
+		k, err := s.repo.GetByID(id)
+		if err != nil {
+			// 引用先が消えているのに無効化されていなければ使わない
+			log.Printf("Cached answer %d cites missing knowledge %d: %v", cached.ID, id, err)
+			return nil
+		}
+		// 列の追加前に保存された行にはスコアがない
+		if i < len(cached.KnowledgeScores) {
+			k.Score = cached.KnowledgeScores[i]
+		}
+		if i < len(cached.KnowledgeSimilarities) {
+			k.Similarity = cached.KnowledgeSimilarities[i]
+		}
+		related = append(related, *k)
+	}
+
+	log.Printf("Answer cache hit (similarity %.3f): %s", cached.Similarity, cached.Question)
+	return &AskResult{
+		Answer:     cached.Answer,
+		Related:    related,
+		FoundCount: len(related),
+		Cached:     true,
+	}
+}
+
+// storeAnswer caches a generated answer for the organization
+func (s *service) storeAnswer(orgID int64, question string, embedding []float32, result *AskResult) {
+	c := CachedAnswer{
+		OrgID:     orgID,
+		Question:  question,
+		Answer:    result.Answer,
+		ExpiresAt: time.Now().Add(s.opts.AnswerCacheTTL),
+	}
+	for _, k := range result.Related {
+		c.KnowledgeIDs = append(c.KnowledgeIDs, k.ID)
+		c.KnowledgeScores = append(c.KnowledgeScores, k.Score)
+		c.KnowledgeSimilarities = append(c.KnowledgeSimilarities, k.Similarity)
+	}
+
+	err := s.repo.SaveCachedAnswer(c, embedding)
+	if err != nil {
+		log.Printf("Failed to cache answer: %v", err)
+	}
+}
+
+// invalidateAnswers drops cached answers grounded in the given entries
+func (s *service) invalidateAnswers(ids ...int) {
+	if err := s.repo.InvalidateCachedAnswers(ids...); err != nil {
+		log.Printf("Failed to invalidate answer cache for %v: %v", ids, err)
+	}
+}
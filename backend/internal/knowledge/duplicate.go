@@ -0,0 +1,174 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"slack-bot/backend/internal/ai"
+)
+
+// DuplicateMode は重複候補が見つかったときの登録ポリシー
+type DuplicateMode string
+
+const (
+	// DuplicateModeOff は重複チェックを行わない
+	DuplicateModeOff DuplicateMode = "off"
+	// DuplicateModeWarn は登録したうえで重複候補を返す
+	DuplicateModeWarn DuplicateMode = "warn"
+	// DuplicateModeConfirm は確認済みでない限り登録しない
+	DuplicateModeConfirm DuplicateMode = "confirm"
+	// DuplicateModeBlock は重複候補があれば登録しない
+	DuplicateModeBlock DuplicateMode = "block"
+)
+
+// maxDuplicateCandidates は類似度を比較する既存ナレッジの件数
+const maxDuplicateCandidates = 5
+
+// Duplicate は重複の可能性がある既存ナレッジ
+type Duplicate struct {
+	ID         int     `json:"id"`
+	Title      string  `json:"title"`
+	Summary    string  `json:"summary,omitempty"`
+	Similarity float64 `json:"similarity"`
+}
+
+// DuplicateError は重複候補があるため登録を保留したことを表す
+type DuplicateError struct {
+	Duplicates []Duplicate
+	// Blocked が false の場合は確認すれば登録できる
+	Blocked bool
+}
+
+func (e *DuplicateError) Error() string {
+	if e.Blocked {
+		return fmt.Sprintf("duplicate knowledge found (%d candidates)", len(e.Duplicates))
+	}
+	return fmt.Sprintf("possible duplicate knowledge requires confirmation (%d candidates)", len(e.Duplicates))
+}
+
+// ErrInvalidMerge は同じナレッジ同士をマージしようとした場合のエラー
+var ErrInvalidMerge = errors.New("source and target must be different knowledge entries")
+
+// ParseDuplicateMode は設定値を DuplicateMode に変換する（不明な値は warn）
+func ParseDuplicateMode(v string) DuplicateMode {
+	switch mode := DuplicateMode(strings.ToLower(strings.TrimSpace(v))); mode {
+	case DuplicateModeOff, DuplicateModeWarn, DuplicateModeConfirm, DuplicateModeBlock:
+		return mode
+	default:
+		return DuplicateModeWarn
+	}
+}
+
+// CreateWithDuplicateCheck compares the new entry's embedding with existing ones
+// before saving. Depending on the duplicate mode it either saves and returns the
+// candidates, or returns a *DuplicateError without saving.
+func (s *service) CreateWithDuplicateCheck(ctx context.Context, orgID int64, k Knowledge, confirmed bool) (int, []Duplicate, error) {
+	ctx = s.withRedaction(ctx, orgID)
+	if s.opts.DuplicateMode == DuplicateModeOff {
+		id, err := s.Create(ctx, orgID, k)
+		return id, nil, err
+	}
+
+	if s.opts.AutoMetadata {
+		s.fillMetadata(ctx, &k)
+	}
+
+	embedding, err := ai.GenerateEmbedding(ctx, k.Content)
+	if err != nil {
+		// 重複チェックできなくても登録自体は続行する
+		log.Printf("Duplicate check skipped: %v", err)
+		id, err := s.insert(ctx, k, nil)
+		return id, nil, err
+	}
+
+	duplicates, err := s.findDuplicates(embedding)
+	if err != nil {
+		log.Printf("Duplicate check failed: %v", err)
+	}
+
+	if len(duplicates) > 0 {
+		switch {
+		case s.opts.DuplicateMode == DuplicateModeBlock:
+			return 0, duplicates, &DuplicateError{Duplicates: duplicates, Blocked: true}
+		case s.opts.DuplicateMode == DuplicateModeConfirm && !confirmed:
+			return 0, duplicates, &DuplicateError{Duplicates: duplicates}
+		}
+	}
+
+	id, err := s.insert(ctx, k, embedding)
+	return id, duplicates, err
+}
+
+// findDuplicates returns existing entries at or above the configured similarity
+func (s *service) findDuplicates(embedding []float32) ([]Duplicate, error) {
+	candidates, err := s.repo.FindNearest(embedding, maxDuplicateCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []Duplicate
+	for _, d := range candidates {
+		if d.Similarity >= s.opts.DuplicateThreshold {
+			duplicates = append(duplicates, d)
+		}
+	}
+	return duplicates, nil
+}
+
+// Merge appends the source entry to the target, deletes the source and
+// redirects the source ID to the target
+func (s *service) Merge(ctx context.Context, orgID int64, sourceID, targetID int) (*Knowledge, error) {
+	if sourceID == targetID {
+		return nil, ErrInvalidMerge
+	}
+
+	source, err := s.repo.GetByID(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source knowledge: %w", err)
+	}
+	target, err := s.repo.GetByID(targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target knowledge: %w", err)
+	}
+
+	merged := *target
+	if !strings.Contains(target.Content, source.Content) {
+		merged.Content = target.Content + "\n\n" + source.Content
+	}
+	merged.Keywords = mergeKeywords(target.Keywords, source.Keywords)
+
+	ctx = s.withRedaction(ctx, orgID)
+	s.prepareUpdate(ctx, &merged)
+	// 外部APIの呼び出しはトランザクションの外で済ませておく
+	embedding, err := ai.GenerateEmbedding(ctx, merged.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+
+	if err := s.repo.MergeInto(ctx, merged, embedding, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to merge knowledge: %w", err)
+	}
+	s.invalidateAnswers(sourceID, targetID)
+
+	return s.repo.GetByID(targetID)
+}
+
+// ResolveRedirect returns the ID a merged entry was moved to
+func (s *service) ResolveRedirect(id int) (int, error) {
+	return s.repo.GetRedirect(id)
+}
+
+func mergeKeywords(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range append(append([]string{}, a...), b...) {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	return out
+}
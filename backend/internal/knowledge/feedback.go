@@ -0,0 +1,51 @@
+package knowledge
+
+import (
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// AnswerFeedback は回答が役に立ったかどうかの評価
+// OrgID・UserID はリクエストボディからは受け付けず、呼び出し元が設定する
+type AnswerFeedback struct {
+	OrgID        int64  `json:"-"`
+	Question     string `json:"question"`
+	KnowledgeIDs []int  `json:"knowledge_ids"`
+	Helpful      bool   `json:"helpful"`
+	// UserID は評価した人（Slack ユーザーID、または Web アプリのユーザーID）
+	UserID string `json:"-"`
+}
+
+// SaveFeedback stores an answer rating
+func (r *repository) SaveFeedback(f AnswerFeedback) error {
+	ids := make(pq.Int64Array, 0, len(f.KnowledgeIDs))
+	for _, id := range f.KnowledgeIDs {
+		ids = append(ids, int64(id))
+	}
+	_, err := r.db.Exec(`
+	INSERT INTO answer_feedback (org_id, question, knowledge_ids, helpful, user_id)
+	VALUES ($1, $2, $3, $4, $5)`,
+		f.OrgID, f.Question, ids, f.Helpful, nullIfEmpty(f.UserID))
+	return err
+}
+
+// DeleteCachedAnswersByQuestion removes the organization's cached answers to exactly this question
+func (r *repository) DeleteCachedAnswersByQuestion(orgID int64, question string) error {
+	_, err := r.db.Exec("DELETE FROM answer_cache WHERE org_id = $1 AND question = $2", orgID, question)
+	return err
+}
+
+// RecordFeedback stores the rating. An answer rated as not helpful is dropped
+// from the answer cache so that the next ask generates a fresh one.
+func (s *service) RecordFeedback(f AnswerFeedback) error {
+	if err := s.repo.SaveFeedback(f); err != nil {
+		return err
+	}
+	if !f.Helpful {
+		if err := s.repo.DeleteCachedAnswersByQuestion(f.OrgID, f.Question); err != nil {
+			log.Printf("Failed to drop cached answer after negative feedback: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 回答できなかった理由
+const (
+	// GapNoResults は関連ナレッジが1件も見つからなかったことを表す
+	GapNoResults = "no_results"
+	// GapNoAnswer は検索結果から回答を作れなかったことを表す
+	GapNoAnswer = "no_answer"
+)
+
+// noAnswerPhrase はナレッジに情報がない場合にモデルへ答えさせている定型文
+const noAnswerPhrase = "関連するナレッジが見つかりませんでした"
+
+// gapClusterThreshold 以上のコサイン類似度の質問を同じクラスタにまとめる
+const gapClusterThreshold = 0.85
+
+// maxGapSamples はクラスタごとにレポートへ載せる質問の件数
+const maxGapSamples = 5
+
+// ErrNoQuestions は下書き作成の対象となる質問がない場合のエラー
+var ErrNoQuestions = errors.New("no unanswered questions found")
+
+// UnansweredQuestion は回答できなかった質問
+type UnansweredQuestion struct {
+	ID        int64     `json:"id"`
+	OrgID     int64     `json:"org_id"`
+	Question  string    `json:"question"`
+	AskedBy   string    `json:"asked_by,omitempty"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+
+	embedding []float32
+}
+
+// GapCluster は似た内容の未回答の質問のまとまり
+type GapCluster struct {
+	// Question はクラスタを代表する質問（最初に聞かれたもの）
+	Question string `json:"question"`
+	// Samples は代表以外も含む質問文の例（重複除去済み）
+	Samples []string `json:"samples"`
+	// Count は質問された回数、People は質問した人数（不明な質問者は1件ごとに数える）
+	Count       int       `json:"count"`
+	People      int       `json:"people"`
+	FirstAsked  time.Time `json:"first_asked"`
+	LastAsked   time.Time `json:"last_asked"`
+	QuestionIDs []int64   `json:"question_ids"`
+
+	centroid []float32
+	askers   map[string]bool
+}
+
+// SaveUnansweredQuestion stores a question that could not be answered
+func (r *repository) SaveUnansweredQuestion(q UnansweredQuestion, embedding []float32) error {
+	var vector any
+	if embedding != nil {
+		vector = fmt.Sprintf("[%s]", float32SliceToString(embedding))
+	}
+	_, err := r.db.Exec(`
+	INSERT INTO unanswered_questions (org_id, question, embedding, asked_by, reason)
+	VALUES ($1, $2, $3, $4, $5)`,
+		q.OrgID, q.Question, vector, nullIfEmpty(q.AskedBy), q.Reason)
+	return err
+}
+
+// ListUnansweredQuestions returns the organization's questions since the given time
+// that have not been turned into a draft yet, oldest first
+func (r *repository) ListUnansweredQuestions(orgID int64, since time.Time) ([]UnansweredQuestion, error) {
+	return r.queryUnanswered(`
+	SELECT id, org_id, question, COALESCE(asked_by, ''), reason, created_at, COALESCE(embedding::text, '')
+	FROM unanswered_questions
+	WHERE org_id = $1 AND created_at >= $2 AND draft_knowledge_id IS NULL
+	ORDER BY created_at, id`, orgID, since)
+}
+
+// GetUnansweredQuestions returns the organization's questions with the given IDs
+func (r *repository) GetUnansweredQuestions(orgID int64, ids []int64) ([]UnansweredQuestion, error) {
+	return r.queryUnanswered(`
+	SELECT id, org_id, question, COALESCE(asked_by, ''), reason, created_at, ''
+	FROM unanswered_questions
+	WHERE org_id = $1 AND id = ANY($2)
+	ORDER BY created_at, id`, orgID, pq.Int64Array(ids))
+}
+
+// MarkQuestionsDrafted links questions to the draft created from them
+func (r *repository) MarkQuestionsDrafted(ids []int64, knowledgeID int) error {
+	_, err := r.db.Exec("UPDATE unanswered_questions SET draft_knowledge_id = $1 WHERE id = ANY($2)", knowledgeID, pq.Int64Array(ids))
+	return err
+}
+
+func (r *repository) queryUnanswered(query string, args ...any) ([]UnansweredQuestion, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []UnansweredQuestion
+	for rows.Next() {
+		var q UnansweredQuestion
+		var vector string
+		if err := rows.Scan(&q.ID, &q.OrgID, &q.Question, &q.AskedBy, &q.Reason, &q.CreatedAt, &vector); err != nil {
+			return nil, err
+		}
+		q.embedding = parseVector(vector)
+		result = append(result, q)
+	}
+	return result, rows.Err()
+}
+
+// recordUnanswered persists a question the knowledge base could not answer
+func (s *service) recordUnanswered(req AskRequest, embedding []float32, reason string) {
+	err := s.repo.SaveUnansweredQuestion(UnansweredQuestion{
+		OrgID:    req.OrgID,
+		Question: req.Question,
+		AskedBy:  req.AskedBy,
+		Reason:   reason,
+	}, embedding)
+	if err != nil {
+		log.Printf("Failed to record unanswered question: %v", err)
+	}
+}
+
+// GapReport clusters the organization's unanswered questions since the given time,
+// most asked first
+func (s *service) GapReport(orgID int64, since time.Time) ([]GapCluster, error) {
+	questions, err := s.repo.ListUnansweredQuestions(orgID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := clusterQuestions(questions)
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].People != clusters[j].People {
+			return clusters[i].People > clusters[j].People
+		}
+		return clusters[i].Count > clusters[j].Count
+	})
+	return clusters, nil
+}
+
+// CreateDraftFromGap creates a draft knowledge entry listing the given questions
+// and removes them from later gap reports
+func (s *service) CreateDraftFromGap(ctx context.Context, orgID int64, questionIDs []int64) (*Knowledge, error) {
+	questions, err := s.repo.GetUnansweredQuestions(orgID, questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(questions) == 0 {
+		return nil, ErrNoQuestions
+	}
+
+	cluster := clusterQuestions(questions)[0]
+	var b strings.Builder
+	b.WriteString("以下の質問に回答できるナレッジがありません。回答を記入して公開してください。\n\n")
+	for _, q := range cluster.Samples {
+		b.WriteString("- " + q + "\n")
+	}
+
+	k := Knowledge{
+		Title:     truncateRunes(cluster.Question, 100),
+		Content:   strings.TrimSpace(b.String()),
+		Status:    StatusDraft,
+		CreatedBy: "knowledge-gap",
+	}
+	id, err := s.Create(ctx, orgID, k)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(questions))
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	if err := s.repo.MarkQuestionsDrafted(ids, id); err != nil {
+		log.Printf("Failed to link questions to draft %d: %v", id, err)
+	}
+
+	return s.repo.GetByID(id)
+}
+
+// clusterQuestions greedily assigns each question to the most similar existing
+// cluster, or starts a new one. Questions without an embedding are grouped by
+// their normalized text.
+func clusterQuestions(questions []UnansweredQuestion) []GapCluster {
+	var clusters []*GapCluster
+	byText := map[string]*GapCluster{}
+
+	for _, q := range questions {
+		key := normalizeText(strings.TrimSpace(q.Question))
+
+		var best *GapCluster
+		if c, ok := byText[key]; ok {
+			best = c
+		} else if q.embedding != nil {
+			bestSim := gapClusterThreshold
+			for _, c := range clusters {
+				if c.centroid == nil {
+					continue
+				}
+				if sim := cosineSimilarity(c.centroid, q.embedding); sim >= bestSim {
+					best, bestSim = c, sim
+				}
+			}
+		}
+
+		if best == nil {
+			best = &GapCluster{Question: q.Question, FirstAsked: q.CreatedAt, askers: map[string]bool{}}
+			clusters = append(clusters, best)
+		}
+		byText[key] = best
+		best.add(q)
+	}
+
+	result := make([]GapCluster, 0, len(clusters))
+	for _, c := range clusters {
+		result = append(result, *c)
+	}
+	return result
+}
+
+func (c *GapCluster) add(q UnansweredQuestion) {
+	c.Count++
+	c.QuestionIDs = append(c.QuestionIDs, q.ID)
+	c.LastAsked = q.CreatedAt
+
+	asker := q.AskedBy
+	if asker == "" {
+		asker = "#" + strconv.FormatInt(q.ID, 10)
+	}
+	if !c.askers[asker] {
+		c.askers[asker] = true
+		c.People++
+	}
+
+	if len(c.Samples) < maxGapSamples {
+		found := false
+		for _, s := range c.Samples {
+			if s == q.Question {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Samples = append(c.Samples, q.Question)
+		}
+	}
+
+	// 重心は埋め込みの合計で持つ（コサイン類似度は大きさに依存しない）
+	if q.embedding != nil {
+		if c.centroid == nil {
+			c.centroid = make([]float32, len(q.embedding))
+		}
+		if len(c.centroid) == len(q.embedding) {
+			for i, v := range q.embedding {
+				c.centroid[i] += v
+			}
+		}
+	}
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// parseVector parses pgvector's text form ("[0.1,0.2,...]")
+func parseVector(s string) []float32 {
+	s = strings.Trim(strings.TrimSpace(s), "[]")
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make([]float32, 0, len(parts))
+	for _, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return nil
+		}
+		out = append(out, float32(f))
+	}
+	return out
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-3]) + "..."
+}
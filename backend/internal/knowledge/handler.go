@@ -2,12 +2,15 @@ package knowledge
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"slack-bot/backend/internal/ai"
 	"strconv"
 	"strings"
+	"time"
+
+	"slack-bot/backend/internal/auth"
 )
 
 func (h *Handler) HandleAsk(w http.ResponseWriter, r *http.Request) {
@@ -16,9 +19,7 @@ func (h *Handler) HandleAsk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Question string `json:"question"`
-	}
+	var req AskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid body", http.StatusBadRequest)
 		return
@@ -29,69 +30,44 @@ func (h *Handler) HandleAsk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Processing question: %s", req.Question)
-
-	// 1. 類似ナレッジ検索（Embedding生成 → DB検索）
-	results, err := h.service.SearchSimilar(r.Context(), req.Question, 10)
+	// Web からの質問は Slack ユーザーに紐付かないため、質問履歴には記録しない（AskedBy は空）
+	resp, err := h.service.Ask(r.Context(), AskRequest{Question: req.Question, OrgID: auth.CurrentOrgID(r)})
 	if err != nil {
-		log.Printf("Search failed: %v", err)
-		// エラーの場合でも基本的な回答を返す
-		resp := map[string]interface{}{
-			"answer":  "申し訳ございませんが、現在ナレッジベースにアクセスできません。しばらく後で再試行してください。",
-			"related": []Knowledge{},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		log.Printf("Ask failed: %v", err)
+		http.Error(w, "Failed to generate answer", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Found %d similar knowledge items", len(results))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	// 2. 検索結果をコンテキストとして整理（ナレッジベース情報のみ）
-	var context strings.Builder
-	if len(results) == 0 {
-		context.WriteString("該当するナレッジがありません。")
-	} else {
-		context.WriteString("登録されたナレッジベース情報:\n\n")
-		for _, k := range results {
-			// 200文字制限を考慮してコンテンツを簡潔に
-			content := k.Content
-			if len([]rune(content)) > 150 {
-				runes := []rune(content)
-				content = string(runes[:147]) + "..."
-			}
-			context.WriteString(fmt.Sprintf("【%s】\n%s\n\n", k.Title, content))
-		}
+// HandleFeedback はログイン中のユーザーによる回答の評価（役に立った / 役に立たなかった）を記録する。
+// 組織と評価者はセッションから決める（auth.RequireAuth の内側で使う）
+func (h *Handler) HandleFeedback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	// 3. OpenAI GPTで回答生成
-	answer, err := ai.GenerateAnswer(req.Question, context.String())
-	if err != nil {
-		log.Printf("GPT error: %v", err)
-		// GPTエラーの場合はシンプルな回答を返す（200文字制限適用）
-		if len(results) > 0 {
-			answer = fmt.Sprintf("質問「%s」について、登録されたナレッジから以下の情報が見つかりました。詳細については個別にお聞きください。", req.Question)
-		} else {
-			answer = "申し訳ございません。関連するナレッジが見つかりませんでした。別のキーワードで検索するか、新しいナレッジを登録してください。"
-		}
-		// 200文字制限を適用
-		if len([]rune(answer)) > 200 {
-			runes := []rune(answer)
-			answer = string(runes[:197]) + "..."
-		}
+	var f AnswerFeedback
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil || f.Question == "" {
+		http.Error(w, "question is required", http.StatusBadRequest)
+		return
 	}
-
-	log.Printf("Generated answer: %s", answer)
-
-	// 4. レスポンス返す
-	resp := map[string]interface{}{
-		"answer":      answer,
-		"related":     results,
-		"found_count": len(results),
+	user := auth.CurrentUser(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
+	f.OrgID, f.UserID = user.OrgID, user.ID
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	if err := h.service.RecordFeedback(f); err != nil {
+		log.Printf("Failed to record feedback: %v", err)
+		http.Error(w, "Failed to record feedback", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 type Handler struct {
@@ -119,12 +95,29 @@ func (h *Handler) HandleKnowledge(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if !validVisibility(k.Visibility) {
+			http.Error(w, "Invalid visibility", http.StatusBadRequest)
+			return
+		}
+
 		// Set default created_by if not provided
 		if k.CreatedBy == "" {
 			k.CreatedBy = "user"
 		}
 
-		id, err := h.service.Create(r.Context(), k)
+		confirmed := r.URL.Query().Get("confirm") == "true"
+		id, duplicates, err := h.service.CreateWithDuplicateCheck(r.Context(), auth.CurrentOrgID(r), k, confirmed)
+		var dupErr *DuplicateError
+		if errors.As(err, &dupErr) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":                 "Similar knowledge already exists",
+				"duplicates":            dupErr.Duplicates,
+				"requires_confirmation": !dupErr.Blocked,
+			})
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to create knowledge: %v", err)
 			http.Error(w, "Failed to create knowledge", http.StatusInternalServerError)
@@ -141,7 +134,10 @@ func (h *Handler) HandleKnowledge(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(created)
+		json.NewEncoder(w).Encode(struct {
+			*Knowledge
+			Duplicates []Duplicate `json:"duplicates,omitempty"`
+		}{created, duplicates})
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -168,7 +164,7 @@ func (h *Handler) HandleRegenerateEmbeddings(w http.ResponseWriter, r *http.Requ
 
 	for _, k := range allKnowledge {
 		// Embeddingを再生成して保存
-		err := h.service.RegenerateEmbedding(r.Context(), k.ID, k.Content)
+		err := h.service.RegenerateEmbedding(r.Context(), auth.CurrentOrgID(r), k.ID, k.Content)
 		if err != nil {
 			log.Printf("Failed to regenerate embedding for ID %d: %v", k.ID, err)
 			errors++
@@ -189,10 +185,108 @@ func (h *Handler) HandleRegenerateEmbeddings(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(result)
 }
 
+// HandleMerge は source のナレッジを target に統合し、source のIDを target へリダイレクトする
+func (h *Handler) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SourceID int `json:"source_id"`
+		TargetID int `json:"target_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SourceID == 0 || req.TargetID == 0 {
+		http.Error(w, "source_id and target_id are required", http.StatusBadRequest)
+		return
+	}
+
+	merged, err := h.service.Merge(r.Context(), auth.CurrentOrgID(r), req.SourceID, req.TargetID)
+	if errors.Is(err, ErrInvalidMerge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to merge knowledge %d into %d: %v", req.SourceID, req.TargetID, err)
+		http.Error(w, "Failed to merge knowledge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
+// HandleGapReport は指定期間（days、既定7日）に回答できなかった質問を類似度でまとめて返す
+func (h *Handler) HandleGapReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	clusters, err := h.service.GapReport(auth.CurrentOrgID(r), since)
+	if err != nil {
+		log.Printf("Failed to build knowledge gap report: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"since":    since,
+		"clusters": clusters,
+	})
+}
+
+// HandleGapDraft はナレッジ不足レポートのクラスタ（question_ids）から下書きのナレッジを作成する
+func (h *Handler) HandleGapDraft(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		QuestionIDs []int64 `json:"question_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.QuestionIDs) == 0 {
+		http.Error(w, "question_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := h.service.CreateDraftFromGap(r.Context(), auth.CurrentOrgID(r), req.QuestionIDs)
+	if errors.Is(err, ErrNoQuestions) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create draft from knowledge gap: %v", err)
+		http.Error(w, "Failed to create draft", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(draft)
+}
+
 func (h *Handler) HandleKnowledgeByID(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from URL path like /api/knowledge/123
+	// Extract ID from URL path like /api/knowledge/123 or /api/knowledge/123/accept-suggestion
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 3 {
+	action := ""
+	if last := pathParts[len(pathParts)-1]; last == "accept-suggestion" {
+		action = last
+		pathParts = pathParts[:len(pathParts)-1]
+	}
+	if len(pathParts) < 2 {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
@@ -204,10 +298,21 @@ func (h *Handler) HandleKnowledgeByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if action == "accept-suggestion" {
+		h.handleAcceptSuggestion(w, r, id)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		knowledge, err := h.service.GetByID(id)
 		if err != nil {
+			// マージ済みのIDは統合先へリダイレクト
+			if newID, rerr := h.service.ResolveRedirect(id); rerr == nil {
+				pathParts[len(pathParts)-1] = strconv.Itoa(newID)
+				http.Redirect(w, r, "/"+strings.Join(pathParts, "/"), http.StatusMovedPermanently)
+				return
+			}
 			http.Error(w, "Knowledge not found", http.StatusNotFound)
 			return
 		}
@@ -222,8 +327,12 @@ func (h *Handler) HandleKnowledgeByID(w http.ResponseWriter, r *http.Request) {
 		}
 
 		k.ID = id // Ensure the ID matches the URL
+		if !validVisibility(k.Visibility) {
+			http.Error(w, "Invalid visibility", http.StatusBadRequest)
+			return
+		}
 
-		if err := h.service.Update(r.Context(), k); err != nil {
+		if err := h.service.Update(r.Context(), auth.CurrentOrgID(r), k); err != nil {
 			log.Printf("Failed to update knowledge: %v", err)
 			http.Error(w, "Failed to update knowledge", http.StatusInternalServerError)
 			return
@@ -252,3 +361,31 @@ func (h *Handler) HandleKnowledgeByID(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// handleAcceptSuggestion は生成されたタイトル案をタイトルとして採用する
+func (h *Handler) handleAcceptSuggestion(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.service.AcceptSuggestedTitle(id); err != nil {
+		http.Error(w, "No suggestion to accept", http.StatusNotFound)
+		return
+	}
+
+	updated, err := h.service.GetByID(id)
+	if err != nil {
+		log.Printf("Failed to get updated knowledge: %v", err)
+		http.Error(w, "Failed to get updated knowledge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// validVisibility は公開範囲の指定が正しいかを返す（空は既定値・変更なし）
+func validVisibility(v string) bool {
+	return v == "" || v == VisibilityPublic || v == VisibilityPrivate
+}
@@ -0,0 +1,92 @@
+package knowledge
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// askHistoryAnswerRunes は履歴に保存する回答の長さ
+const askHistoryAnswerRunes = 500
+
+// AskHistory は質問の履歴
+type AskHistory struct {
+	ID      int64  `json:"id"`
+	OrgID   int64  `json:"org_id"`
+	AskedBy string `json:"asked_by"`
+	// Question・Answer は質問者本人が入力・受け取った内容（伏せ字を戻した後）
+	Question     string    `json:"question"`
+	Answer       string    `json:"answer"`
+	KnowledgeIDs []int     `json:"knowledge_ids"`
+	Answered     bool      `json:"answered"`
+	Cached       bool      `json:"cached"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SaveAskHistory stores an asked question and the answer given
+func (r *repository) SaveAskHistory(h AskHistory) error {
+	ids := make(pq.Int64Array, 0, len(h.KnowledgeIDs))
+	for _, id := range h.KnowledgeIDs {
+		ids = append(ids, int64(id))
+	}
+	_, err := r.db.Exec(`
+	INSERT INTO ask_history (org_id, asked_by, question, answer, knowledge_ids, answered, cached)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		h.OrgID, h.AskedBy, h.Question, h.Answer, ids, h.Answered, h.Cached)
+	return err
+}
+
+// ListAskHistory returns the asker's most recent questions, newest first
+func (r *repository) ListAskHistory(askedBy string, limit int) ([]AskHistory, error) {
+	rows, err := r.db.Query(`
+	SELECT id, org_id, asked_by, question, answer, knowledge_ids, answered, cached, created_at
+	FROM ask_history
+	WHERE asked_by = $1
+	ORDER BY created_at DESC
+	LIMIT $2`, askedBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AskHistory
+	for rows.Next() {
+		var h AskHistory
+		var ids pq.Int64Array
+		if err := rows.Scan(&h.ID, &h.OrgID, &h.AskedBy, &h.Question, &h.Answer, &ids, &h.Answered, &h.Cached, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			h.KnowledgeIDs = append(h.KnowledgeIDs, int(id))
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// recordAsk stores the question in the asker's history. Questions without an asker are not recorded.
+func (s *service) recordAsk(req AskRequest, result *AskResult, answered bool) {
+	if req.AskedBy == "" {
+		return
+	}
+	h := AskHistory{
+		OrgID:    req.OrgID,
+		AskedBy:  req.AskedBy,
+		Question: req.Question,
+		Answer:   truncateRunes(result.Answer, askHistoryAnswerRunes),
+		Answered: answered,
+		Cached:   result.Cached,
+	}
+	for _, k := range result.Related {
+		h.KnowledgeIDs = append(h.KnowledgeIDs, k.ID)
+	}
+	if err := s.repo.SaveAskHistory(h); err != nil {
+		log.Printf("Failed to record ask history: %v", err)
+	}
+}
+
+// RecentQuestions returns the asker's most recent questions
+func (s *service) RecentQuestions(askedBy string, limit int) ([]AskHistory, error) {
+	return s.repo.ListAskHistory(askedBy, limit)
+}
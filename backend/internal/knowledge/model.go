@@ -2,10 +2,42 @@ package knowledge
 
 import "time"
 
+const (
+	// StatusPublished は検索・回答の対象になる公開済みのナレッジ
+	StatusPublished = "published"
+	// StatusDraft は下書き（検索・回答の対象外）
+	StatusDraft = "draft"
+
+	// VisibilityPublic は組織全体に公開されたナレッジ
+	VisibilityPublic = "public"
+	// VisibilityPrivate は作成者のみのナレッジ（検索・回答の対象外）
+	VisibilityPrivate = "private"
+)
+
 type Knowledge struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
+	ID             int      `json:"id"`
+	Title          string   `json:"title"`
+	Content        string   `json:"content"`
+	Summary        string   `json:"summary"`
+	Keywords       []string `json:"keywords"`
+	SuggestedTitle string   `json:"suggested_title,omitempty"`
+	// InjectionFlags は保存時に検出したプロンプトインジェクションの疑い
+	InjectionFlags []string `json:"injection_flags,omitempty"`
+	// Status は StatusPublished または StatusDraft（更新時に空なら変更しない）
+	Status string   `json:"status,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	// Visibility は VisibilityPublic または VisibilityPrivate（更新時に空なら変更しない）
+	Visibility string `json:"visibility,omitempty"`
+	// SourceURL は出典（Slack スレッドのパーマリンクなど）
+	SourceURL string    `json:"source_url,omitempty"`
 	CreatedBy string    `json:"created_by"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 検索結果のみで設定される。Score は検索方法ごとの並び順の値（ベクトル検索ではコサイン類似度、
+	// 全文検索では ts_rank）で、検索方法をまたいで比較できない
+	Score   float64 `json:"score,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+	// Similarity はベクトル検索のコサイン類似度（全文検索の結果では 0）
+	Similarity float64 `json:"similarity,omitempty"`
 }
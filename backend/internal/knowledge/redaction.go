@@ -0,0 +1,81 @@
+package knowledge
+
+import (
+	"context"
+	"log"
+
+	"slack-bot/backend/internal/ai"
+	"slack-bot/backend/internal/security"
+)
+
+// RedactionRule は組織ごとに追加できる伏せ字ルール（org_id が NULL のものは全組織に適用）
+type RedactionRule struct {
+	ID      int    `json:"id"`
+	OrgID   int64  `json:"org_id,omitempty"`
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Restore bool   `json:"restore"`
+}
+
+// GetRedactionRules returns the rules common to all organizations plus those of orgID
+func (r *repository) GetRedactionRules(orgID int64) ([]RedactionRule, error) {
+	rows, err := r.db.Query(`
+	SELECT id, COALESCE(org_id, 0), name, pattern, restore
+	FROM redaction_rules
+	WHERE enabled AND (org_id IS NULL OR org_id = $1)
+	ORDER BY id`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []RedactionRule
+	for rows.Next() {
+		var rule RedactionRule
+		if err := rows.Scan(&rule.ID, &rule.OrgID, &rule.Name, &rule.Pattern, &rule.Restore); err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, rows.Err()
+}
+
+// withRedaction sets the organization's redactor on ctx unless one is already set,
+// so that every external AI call made with ctx is redacted
+func (s *service) withRedaction(ctx context.Context, orgID int64) context.Context {
+	if ai.HasRedactor(ctx) {
+		return ctx
+	}
+	return ai.WithRedactor(ctx, s.redactorFor(orgID))
+}
+
+// redactorFor builds the redactor from the configured built-in rules and the
+// organization's custom rules (orgID 0 = only rules common to all organizations)
+func (s *service) redactorFor(orgID int64) *security.Redactor {
+	if !s.opts.RedactionEnabled {
+		empty, _ := security.NewRedactor(nil)
+		return empty
+	}
+
+	var custom []security.RedactionRule
+	rules, err := s.repo.GetRedactionRules(orgID)
+	if err != nil {
+		log.Printf("Failed to load redaction rules for org %d: %v", orgID, err)
+	}
+	for _, rule := range rules {
+		compiled, err := security.CompileRedactionRule(rule.Name, rule.Pattern, rule.Restore)
+		if err != nil {
+			log.Printf("Skipping redaction rule %d: %v", rule.ID, err)
+			continue
+		}
+		custom = append(custom, compiled)
+	}
+
+	redactor, err := security.NewRedactor(s.opts.RedactionRules, custom...)
+	if err != nil {
+		// 設定ミスで伏せ字が無効にならないよう、組み込みルールすべてで代替する
+		log.Printf("Invalid redaction config, falling back to defaults: %v", err)
+		redactor, _ = security.NewRedactor(security.DefaultRedactionRules, custom...)
+	}
+	return redactor
+}
@@ -0,0 +1,65 @@
+package knowledge
+
+import (
+	"context"
+	"testing"
+
+	"slack-bot/backend/internal/ai"
+	"slack-bot/backend/internal/security"
+)
+
+// redactionRepo は組織ごとの伏せ字ルールだけを返す Repository
+type redactionRepo struct {
+	Repository
+	rules map[int64][]RedactionRule
+}
+
+func (r *redactionRepo) GetRedactionRules(orgID int64) ([]RedactionRule, error) {
+	return append(r.rules[0], r.rules[orgID]...), nil
+}
+
+func TestWithRedaction(t *testing.T) {
+	repo := &redactionRepo{rules: map[int64][]RedactionRule{
+		0: {{ID: 1, Name: "project", Pattern: `PRJ-\d{4}`}},
+		1: {{ID: 2, OrgID: 1, Name: "employee_id", Pattern: `EMP-\d{6}`}},
+		2: {{ID: 3, OrgID: 2, Name: "broken", Pattern: `(`}},
+	}}
+	const text = "EMP-123456 PRJ-0001 taro@example.com 03-1234-5678"
+
+	tests := []struct {
+		name string
+		opts Options
+		org  int64
+		want int
+	}{
+		{"org rules and common rules", Options{RedactionEnabled: true, RedactionRules: security.DefaultRedactionRules}, 1, 4},
+		{"other org does not get org 1 rules", Options{RedactionEnabled: true, RedactionRules: security.DefaultRedactionRules}, 3, 3},
+		{"invalid org rule is skipped", Options{RedactionEnabled: true, RedactionRules: security.DefaultRedactionRules}, 2, 3},
+		{"only configured builtins", Options{RedactionEnabled: true, RedactionRules: []string{security.RedactEmail}}, 1, 3},
+		{"unknown builtin falls back to all builtins", Options{RedactionEnabled: true, RedactionRules: []string{"ssn"}}, 1, 4},
+		{"disabled", Options{RedactionEnabled: false, RedactionRules: security.DefaultRedactionRules}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{repo: repo, opts: tt.opts}
+			ctx := s.withRedaction(context.Background(), tt.org)
+			if got := ai.CountRedactions(ctx, text); got != tt.want {
+				t.Errorf("CountRedactions(%q) for org %d = %d, want %d", text, tt.org, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRedactionKeepsExistingRedactor(t *testing.T) {
+	s := &service{repo: &redactionRepo{}, opts: Options{RedactionEnabled: true, RedactionRules: security.DefaultRedactionRules}}
+	none, err := security.NewRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 呼び出し元で設定済みの Redactor（組織のルール）は上書きしない
+	ctx := s.withRedaction(ai.WithRedactor(context.Background(), none), 1)
+	if got := ai.CountRedactions(ctx, "taro@example.com"); got != 0 {
+		t.Errorf("CountRedactions = %d, want 0 (existing redactor replaced)", got)
+	}
+}
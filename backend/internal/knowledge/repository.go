@@ -5,11 +5,18 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type Repository interface {
 	GetAll() ([]Knowledge, error)
 	GetByID(id int) (*Knowledge, error)
+	GetByAuthor(createdBy string, limit int) ([]Knowledge, error)
+	ListByStatus(status string, limit int) ([]Knowledge, error)
+	ListChangedSince(since time.Time, limit int) ([]Knowledge, error)
+	CountChangedSince(since time.Time) (created, updated int, err error)
 	Create(k Knowledge) (int, error)
 	Update(k Knowledge) error
 	Delete(id int) error
@@ -17,6 +24,22 @@ type Repository interface {
 	DeleteEmbedding(id int) error
 	SearchSimilar(embedding []float32, limit int) ([]Knowledge, error)
 	SearchByText(query string, limit int) ([]Knowledge, error)
+	ReindexMissing() (int, error)
+	FindNearest(embedding []float32, limit int) ([]Duplicate, error)
+	MergeInto(ctx context.Context, target Knowledge, embedding []float32, sourceID int) error
+	GetRedirect(id int) (int, error)
+	GetRedactionRules(orgID int64) ([]RedactionRule, error)
+	FindCachedAnswer(orgID int64, embedding []float32, minSimilarity float64) (*CachedAnswer, error)
+	SaveCachedAnswer(c CachedAnswer, embedding []float32) error
+	InvalidateCachedAnswers(knowledgeIDs ...int) error
+	SaveUnansweredQuestion(q UnansweredQuestion, embedding []float32) error
+	ListUnansweredQuestions(orgID int64, since time.Time) ([]UnansweredQuestion, error)
+	GetUnansweredQuestions(orgID int64, ids []int64) ([]UnansweredQuestion, error)
+	MarkQuestionsDrafted(ids []int64, knowledgeID int) error
+	SaveFeedback(f AnswerFeedback) error
+	DeleteCachedAnswersByQuestion(orgID int64, question string) error
+	SaveAskHistory(h AskHistory) error
+	ListAskHistory(askedBy string, limit int) ([]AskHistory, error)
 }
 
 type repository struct {
@@ -27,8 +50,28 @@ func NewRepository(db *sql.DB) Repository {
 	return &repository{db: db}
 }
 
+// knowledgeColumns は Knowledge を読み出す際の列（テーブル別名 k）。scanKnowledge と順序を合わせる
+const knowledgeColumns = `k.id, k.title, k.content, COALESCE(k.summary, ''), k.keywords,
+	COALESCE(k.suggested_title, ''), k.injection_flags, COALESCE(k.status, 'published'),
+	k.tags, COALESCE(k.visibility, 'public'), COALESCE(k.source_url, ''), COALESCE(k.created_by, 'user'), COALESCE(k.created_at, NOW()),
+	COALESCE(k.updated_at, k.created_at, NOW())`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanKnowledge reads knowledgeColumns followed by any extra columns
+func scanKnowledge(row rowScanner, extra ...any) (Knowledge, error) {
+	var k Knowledge
+	dest := []any{&k.ID, &k.Title, &k.Content, &k.Summary, pq.Array(&k.Keywords),
+		&k.SuggestedTitle, pq.Array(&k.InjectionFlags), &k.Status,
+		pq.Array(&k.Tags), &k.Visibility, &k.SourceURL, &k.CreatedBy, &k.CreatedAt, &k.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	return k, err
+}
+
 func (r *repository) GetAll() ([]Knowledge, error) {
-	rows, err := r.db.Query("SELECT id, title, content, COALESCE(created_by, 'user') as created_by, COALESCE(created_at, NOW()) as created_at FROM knowledge ORDER BY id DESC")
+	rows, err := r.db.Query("SELECT " + knowledgeColumns + " FROM knowledge k ORDER BY k.id DESC")
 	if err != nil {
 		return nil, err
 	}
@@ -36,8 +79,8 @@ func (r *repository) GetAll() ([]Knowledge, error) {
 
 	var result []Knowledge
 	for rows.Next() {
-		var k Knowledge
-		if err := rows.Scan(&k.ID, &k.Title, &k.Content, &k.CreatedBy, &k.CreatedAt); err != nil {
+		k, err := scanKnowledge(rows)
+		if err != nil {
 			return nil, err
 		}
 		result = append(result, k)
@@ -46,24 +89,124 @@ func (r *repository) GetAll() ([]Knowledge, error) {
 }
 
 func (r *repository) GetByID(id int) (*Knowledge, error) {
-	row := r.db.QueryRow("SELECT id, title, content, created_by, created_at FROM knowledge WHERE id=$1", id)
-	var k Knowledge
-	if err := row.Scan(&k.ID, &k.Title, &k.Content, &k.CreatedBy, &k.CreatedAt); err != nil {
+	row := r.db.QueryRow("SELECT "+knowledgeColumns+" FROM knowledge k WHERE k.id=$1", id)
+	k, err := scanKnowledge(row)
+	if err != nil {
 		return nil, err
 	}
 	return &k, nil
 }
 
+// GetByAuthor returns the author's entries, newest first
+func (r *repository) GetByAuthor(createdBy string, limit int) ([]Knowledge, error) {
+	rows, err := r.db.Query("SELECT "+knowledgeColumns+" FROM knowledge k WHERE k.created_by=$1 ORDER BY k.id DESC LIMIT $2", createdBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Knowledge
+	for rows.Next() {
+		k, err := scanKnowledge(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, k)
+	}
+	return result, rows.Err()
+}
+
+// ListByStatus returns entries with the status, newest first
+func (r *repository) ListByStatus(status string, limit int) ([]Knowledge, error) {
+	rows, err := r.db.Query("SELECT "+knowledgeColumns+" FROM knowledge k WHERE COALESCE(k.status, 'published')=$1 ORDER BY k.id DESC LIMIT $2", status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Knowledge
+	for rows.Next() {
+		k, err := scanKnowledge(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, k)
+	}
+	return result, rows.Err()
+}
+
+// ListChangedSince returns published, public entries created or updated since the time, newest first
+func (r *repository) ListChangedSince(since time.Time, limit int) ([]Knowledge, error) {
+	rows, err := r.db.Query(`
+	SELECT `+knowledgeColumns+`
+	FROM knowledge k
+	WHERE COALESCE(k.updated_at, k.created_at) >= $1
+		AND COALESCE(k.status, 'published') = 'published'
+		AND COALESCE(k.visibility, 'public') = 'public'
+	ORDER BY COALESCE(k.updated_at, k.created_at) DESC
+	LIMIT $2`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Knowledge
+	for rows.Next() {
+		k, err := scanKnowledge(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, k)
+	}
+	return result, rows.Err()
+}
+
+// CountChangedSince counts the published, public entries created and the ones
+// only updated since the time (ListChangedSince returns at most limit of them)
+func (r *repository) CountChangedSince(since time.Time) (created, updated int, err error) {
+	err = r.db.QueryRow(`
+	SELECT
+		COUNT(*) FILTER (WHERE k.created_at >= $1),
+		COUNT(*) FILTER (WHERE k.created_at < $1)
+	FROM knowledge k
+	WHERE COALESCE(k.updated_at, k.created_at) >= $1
+		AND COALESCE(k.status, 'published') = 'published'
+		AND COALESCE(k.visibility, 'public') = 'public'`, since).Scan(&created, &updated)
+	return created, updated, err
+}
+
 func (r *repository) Create(k Knowledge) (int, error) {
 	var id int
-	err := r.db.QueryRow("INSERT INTO knowledge (title, content, created_by, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id",
-		k.Title, k.Content, k.CreatedBy).Scan(&id)
+	searchTitle, searchBody := searchColumns(k)
+	status := k.Status
+	if status == "" {
+		status = StatusPublished
+	}
+	visibility := k.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	err := r.db.QueryRow("INSERT INTO knowledge (title, content, summary, keywords, suggested_title, injection_flags, search_title, search_body, status, tags, visibility, source_url, created_by, created_at, updated_at) VALUES ($1, $2, $3, $4, NULLIF($5, $1), $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW()) RETURNING id",
+		k.Title, k.Content, nullIfEmpty(k.Summary), pq.Array(k.Keywords), nullIfEmpty(k.SuggestedTitle), pq.Array(k.InjectionFlags), searchTitle, searchBody, status, pq.Array(k.Tags), visibility, nullIfEmpty(k.SourceURL), k.CreatedBy).Scan(&id)
 	return id, err
 }
 
+// execer は *sql.DB と *sql.Tx に共通する書き込み操作
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 func (r *repository) Update(k Knowledge) error {
-	_, err := r.db.Exec("UPDATE knowledge SET title=$1, content=$2 WHERE id=$3",
-		k.Title, k.Content, k.ID)
+	return updateKnowledge(r.db, k)
+}
+
+func updateKnowledge(db execer, k Knowledge) error {
+	searchTitle, searchBody := searchColumns(k)
+	// 要約・キーワード・タイトル案・status・tags・visibility は指定がなければ変更しない。
+	// タイトル案は新しいタイトルと同じなら不要なので消す
+	_, err := db.Exec("UPDATE knowledge SET title=$1, content=$2, summary=COALESCE($3, summary), keywords=COALESCE($4, keywords), suggested_title=NULLIF(COALESCE($5, suggested_title), $1), injection_flags=$6, search_title=$7, search_body=$8, status=COALESCE(NULLIF($9, ''), status), tags=COALESCE($10, tags), visibility=COALESCE(NULLIF($11, ''), visibility), updated_at=NOW() WHERE id=$12",
+		k.Title, k.Content, nullIfEmpty(k.Summary), pq.Array(k.Keywords), nullIfEmpty(k.SuggestedTitle), pq.Array(k.InjectionFlags), searchTitle, searchBody, k.Status, pq.Array(k.Tags), k.Visibility, k.ID)
 	return err
 }
 
@@ -74,10 +217,14 @@ func (r *repository) Delete(id int) error {
 
 // SaveEmbedding saves the embedding for a knowledge entry
 func (r *repository) SaveEmbedding(ctx context.Context, knowledgeID int64, embedding []float32) error {
+	return saveEmbedding(ctx, r.db, knowledgeID, embedding)
+}
+
+func saveEmbedding(ctx context.Context, db execer, knowledgeID int64, embedding []float32) error {
 	// Convert []float32 to pgvector format
 	vector := fmt.Sprintf("[%s]", float32SliceToString(embedding))
 
-	_, err := r.db.ExecContext(ctx,
+	_, err := db.ExecContext(ctx,
 		`INSERT INTO knowledge_embeddings (knowledge_id, embedding) VALUES ($1, $2) 
 		 ON CONFLICT (knowledge_id) DO UPDATE SET embedding = $2`,
 		knowledgeID, vector)
@@ -97,9 +244,10 @@ func (r *repository) SearchSimilar(embedding []float32, limit int) ([]Knowledge,
 	// cosine距離で2.0以下（非常に緩い設定）のものを検索
 	// または閾値なしで上位N件を取得
 	query := `
-	SELECT k.id, k.title, k.content, k.created_by, k.created_at, e.embedding <=> $1 as distance
+	SELECT ` + knowledgeColumns + `, e.embedding <=> $1 as distance
 	FROM knowledge k
 	JOIN knowledge_embeddings e ON k.id = e.knowledge_id
+	WHERE k.status = 'published' AND k.visibility = 'public'
 	ORDER BY e.embedding <=> $1
 	LIMIT $2;
 	`
@@ -112,34 +260,109 @@ func (r *repository) SearchSimilar(embedding []float32, limit int) ([]Knowledge,
 
 	var result []Knowledge
 	for rows.Next() {
-		var k Knowledge
 		var distance float64
-		if err := rows.Scan(&k.ID, &k.Title, &k.Content, &k.CreatedBy, &k.CreatedAt, &distance); err != nil {
+		k, err := scanKnowledge(rows, &distance)
+		if err != nil {
 			return nil, err
 		}
+		k.Score = 1 - distance
+		k.Similarity = k.Score
 		result = append(result, k)
 	}
 
 	return result, nil
 }
 
-// SearchByText performs text-based search as fallback when embedding search fails
+// FindNearest returns the closest entries with their cosine similarity
+func (r *repository) FindNearest(embedding []float32, limit int) ([]Duplicate, error) {
+	vector := fmt.Sprintf("[%s]", float32SliceToString(embedding))
+
+	query := `
+	SELECT k.id, k.title, COALESCE(k.summary, ''), 1 - (e.embedding <=> $1) as similarity
+	FROM knowledge k
+	JOIN knowledge_embeddings e ON k.id = e.knowledge_id
+	WHERE k.status = 'published' AND k.visibility = 'public'
+	ORDER BY e.embedding <=> $1
+	LIMIT $2;
+	`
+
+	rows, err := r.db.Query(query, vector, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Duplicate
+	for rows.Next() {
+		var d Duplicate
+		if err := rows.Scan(&d.ID, &d.Title, &d.Summary, &d.Similarity); err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+
+	return result, rows.Err()
+}
+
+// MergeInto saves the merged target and its embedding, deletes the source entry
+// and redirects its ID (and any IDs already redirected to it) to the target in a
+// single transaction
+func (r *repository) MergeInto(ctx context.Context, target Knowledge, embedding []float32, sourceID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	targetID := target.ID
+	if err := updateKnowledge(tx, target); err != nil {
+		return err
+	}
+	if err := saveEmbedding(ctx, tx, int64(targetID), embedding); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE knowledge_redirects SET new_id=$2 WHERE new_id=$1", sourceID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO knowledge_redirects (old_id, new_id, merged_at) VALUES ($1, $2, NOW())
+		 ON CONFLICT (old_id) DO UPDATE SET new_id = $2, merged_at = NOW()`,
+		sourceID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM knowledge WHERE id=$1", sourceID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRedirect returns the ID a merged entry now lives under
+func (r *repository) GetRedirect(id int) (int, error) {
+	var newID int
+	err := r.db.QueryRow("SELECT new_id FROM knowledge_redirects WHERE old_id=$1", id).Scan(&newID)
+	return newID, err
+}
+
+// SearchByText performs full-text search over the n-gram index as fallback when
+// embedding search fails. Each query term must match as a whole; entries matching
+// more terms (and matches in the title) rank higher.
 func (r *repository) SearchByText(query string, limit int) ([]Knowledge, error) {
-	// PostgreSQLのILIKE（大文字小文字を区別しない）とLIKEを使用
+	terms := QueryTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
 	textQuery := `
-	SELECT id, title, content, created_by, created_at
-	FROM knowledge
-	WHERE title ILIKE '%' || $1 || '%' OR content ILIKE '%' || $1 || '%'
-	ORDER BY 
-		CASE 
-			WHEN title ILIKE '%' || $1 || '%' THEN 1
-			ELSE 2
-		END,
-		id DESC
+	SELECT ` + knowledgeColumns + `, ts_rank(k.search_vector, q) AS rank
+	FROM knowledge k, to_tsquery('simple', $1) q
+	WHERE k.search_vector @@ q AND k.status = 'published' AND k.visibility = 'public'
+	ORDER BY rank DESC, k.id DESC
 	LIMIT $2;
 	`
 
-	rows, err := r.db.Query(textQuery, query, limit)
+	rows, err := r.db.Query(textQuery, buildTSQuery(terms), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -147,14 +370,57 @@ func (r *repository) SearchByText(query string, limit int) ([]Knowledge, error)
 
 	var result []Knowledge
 	for rows.Next() {
-		var k Knowledge
-		if err := rows.Scan(&k.ID, &k.Title, &k.Content, &k.CreatedBy, &k.CreatedAt); err != nil {
+		var rank float64
+		k, err := scanKnowledge(rows, &rank)
+		if err != nil {
 			return nil, err
 		}
+		k.Score = rank
 		result = append(result, k)
 	}
 
-	return result, nil
+	return result, rows.Err()
+}
+
+// ReindexMissing fills the search columns of entries created before the index existed
+func (r *repository) ReindexMissing() (int, error) {
+	rows, err := r.db.Query("SELECT id, title, content, COALESCE(summary, ''), keywords, tags FROM knowledge WHERE search_title IS NULL")
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []Knowledge
+	for rows.Next() {
+		var k Knowledge
+		if err := rows.Scan(&k.ID, &k.Title, &k.Content, &k.Summary, pq.Array(&k.Keywords), pq.Array(&k.Tags)); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, k := range pending {
+		searchTitle, searchBody := searchColumns(k)
+		if _, err := r.db.Exec("UPDATE knowledge SET search_title=$1, search_body=$2 WHERE id=$3", searchTitle, searchBody, k.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+// searchColumns returns the n-gram tokens stored for full-text search
+func searchColumns(k Knowledge) (string, string) {
+	body := append([]string{k.Content, k.Summary}, k.Keywords...)
+	return IndexTokens(k.Title), IndexTokens(append(body, k.Tags...)...)
+}
+
+// nullIfEmpty stores empty optional text columns as NULL
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
 
 // Helper function to convert []float32 to comma-separated string
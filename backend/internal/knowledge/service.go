@@ -2,26 +2,66 @@ package knowledge
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"log"
 	"slack-bot/backend/internal/ai"
+	"slack-bot/backend/internal/security"
+	"time"
 )
 
 type Service interface {
 	GetAll() ([]Knowledge, error)
 	GetByID(id int) (*Knowledge, error)
-	Create(ctx context.Context, k Knowledge) (int, error)
-	Update(ctx context.Context, k Knowledge) error
+	GetByAuthor(createdBy string, limit int) ([]Knowledge, error)
+	ListByStatus(status string, limit int) ([]Knowledge, error)
+	ListChangedSince(since time.Time, limit int) ([]Knowledge, error)
+	CountChangedSince(since time.Time) (created, updated int, err error)
+	Create(ctx context.Context, orgID int64, k Knowledge) (int, error)
+	CreateWithDuplicateCheck(ctx context.Context, orgID int64, k Knowledge, confirmed bool) (int, []Duplicate, error)
+	Merge(ctx context.Context, orgID int64, sourceID, targetID int) (*Knowledge, error)
+	ResolveRedirect(id int) (int, error)
+	Update(ctx context.Context, orgID int64, k Knowledge) error
+	AcceptSuggestedTitle(id int) error
 	Delete(id int) error
-	SearchSimilar(ctx context.Context, query string, limit int) ([]Knowledge, error)
-	RegenerateEmbedding(ctx context.Context, id int, content string) error
+	SearchSimilar(ctx context.Context, orgID int64, query string, limit int) ([]Knowledge, error)
+	GenerateMetadata(ctx context.Context, orgID int64, title, content string) (*ai.Metadata, error)
+	Ask(ctx context.Context, req AskRequest) (*AskResult, error)
+	RecordFeedback(f AnswerFeedback) error
+	RecentQuestions(askedBy string, limit int) ([]AskHistory, error)
+	GapReport(orgID int64, since time.Time) ([]GapCluster, error)
+	CreateDraftFromGap(ctx context.Context, orgID int64, questionIDs []int64) (*Knowledge, error)
+	ReindexSearch() (int, error)
+	RegenerateEmbedding(ctx context.Context, orgID int64, id int, content string) error
+}
+
+// 以下の orgID は操作する人の組織で、外部AIに送るテキストに組織の伏せ字ルールを適用するために使う（0 は全組織共通のルールのみ）
+
+// Options は Service の動作設定
+type Options struct {
+	// AutoMetadata が有効な場合、保存時にタイトル案・要約・キーワードを生成する
+	AutoMetadata bool
+	// DuplicateMode は重複候補が見つかったときの扱い
+	DuplicateMode DuplicateMode
+	// DuplicateThreshold 以上のコサイン類似度を重複候補とみなす
+	DuplicateThreshold float64
+	// RedactionEnabled が有効な場合、外部AIへ送る前に個人情報・秘密情報を伏せ字にする
+	RedactionEnabled bool
+	// RedactionRules は有効にする組み込みルール名（security.DefaultRedactionRules を参照）
+	RedactionRules []string
+	// AnswerCacheTTL は回答キャッシュの有効期間（0 でキャッシュしない）
+	AnswerCacheTTL time.Duration
+	// AnswerCacheThreshold 以上のコサイン類似度の過去の質問にはキャッシュした回答を返す
+	AnswerCacheThreshold float64
 }
 
 type service struct {
 	repo Repository
+	opts Options
 }
 
-func NewService(r Repository) Service {
-	return &service{repo: r}
+func NewService(r Repository, opts Options) Service {
+	return &service{repo: r, opts: opts}
 }
 
 func (s *service) GetAll() ([]Knowledge, error) {
@@ -32,8 +72,36 @@ func (s *service) GetByID(id int) (*Knowledge, error) {
 	return s.repo.GetByID(id)
 }
 
+func (s *service) GetByAuthor(createdBy string, limit int) ([]Knowledge, error) {
+	return s.repo.GetByAuthor(createdBy, limit)
+}
+
+func (s *service) ListByStatus(status string, limit int) ([]Knowledge, error) {
+	return s.repo.ListByStatus(status, limit)
+}
+
+func (s *service) ListChangedSince(since time.Time, limit int) ([]Knowledge, error) {
+	return s.repo.ListChangedSince(since, limit)
+}
+
+// CountChangedSince counts entries created and updated since the time
+func (s *service) CountChangedSince(since time.Time) (created, updated int, err error) {
+	return s.repo.CountChangedSince(since)
+}
+
 // Create saves knowledge and generates embedding
-func (s *service) Create(ctx context.Context, k Knowledge) (int, error) {
+func (s *service) Create(ctx context.Context, orgID int64, k Knowledge) (int, error) {
+	ctx = s.withRedaction(ctx, orgID)
+	if s.opts.AutoMetadata {
+		s.fillMetadata(ctx, &k)
+	}
+	return s.insert(ctx, k, nil)
+}
+
+// insert saves the knowledge and its embedding, generating the embedding if none is given
+func (s *service) insert(ctx context.Context, k Knowledge, embedding []float32) (int, error) {
+	k.InjectionFlags = detectInjection(k)
+
 	// Step 1: Save the knowledge (title, content)
 	id, err := s.repo.Create(k)
 	if err != nil {
@@ -41,9 +109,11 @@ func (s *service) Create(ctx context.Context, k Knowledge) (int, error) {
 	}
 
 	// Step 2: Generate embedding for the content
-	embedding, err := ai.GenerateEmbedding(ctx, k.Content)
-	if err != nil {
-		return id, fmt.Errorf("failed to generate embedding: %w", err)
+	if embedding == nil {
+		embedding, err = ai.GenerateEmbedding(ctx, k.Content)
+		if err != nil {
+			return id, fmt.Errorf("failed to generate embedding: %w", err)
+		}
 	}
 
 	// Step 3: Save the embedding
@@ -54,11 +124,15 @@ func (s *service) Create(ctx context.Context, k Knowledge) (int, error) {
 	return id, nil
 }
 
-func (s *service) Update(ctx context.Context, k Knowledge) error {
+func (s *service) Update(ctx context.Context, orgID int64, k Knowledge) error {
+	ctx = s.withRedaction(ctx, orgID)
+	s.prepareUpdate(ctx, &k)
+
 	// Update the knowledge entry
 	if err := s.repo.Update(k); err != nil {
 		return fmt.Errorf("failed to update knowledge: %w", err)
 	}
+	s.invalidateAnswers(k.ID)
 
 	// Regenerate embedding for updated content
 	embedding, err := ai.GenerateEmbedding(ctx, k.Content)
@@ -74,17 +148,80 @@ func (s *service) Update(ctx context.Context, k Knowledge) error {
 	return nil
 }
 
+// prepareUpdate regenerates metadata when the title or content changed and
+// fills in the fields that are derived from the entry before it is saved
+func (s *service) prepareUpdate(ctx context.Context, k *Knowledge) {
+	existing, err := s.repo.GetByID(k.ID)
+	if err != nil {
+		existing = nil
+	}
+
+	// タイトルも本文も変わっていなければメタデータは作り直さない
+	if s.opts.AutoMetadata && (existing == nil || existing.Title != k.Title || existing.Content != k.Content) {
+		// 本文が変わった場合、作者が手を入れていない要約・キーワードは作り直す
+		if existing != nil && existing.Content != k.Content {
+			if k.Summary == existing.Summary {
+				k.Summary = ""
+			}
+			if equalStrings(k.Keywords, existing.Keywords) {
+				k.Keywords = nil
+			}
+		}
+		s.fillMetadata(ctx, k)
+	}
+
+	// タグの指定がなければ既存のタグを検索インデックスに含める
+	if k.Tags == nil && existing != nil {
+		k.Tags = existing.Tags
+	}
+
+	k.InjectionFlags = detectInjection(*k)
+}
+
+// AcceptSuggestedTitle adopts the generated title suggestion as the entry's title
+func (s *service) AcceptSuggestedTitle(id int) error {
+	k, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if k.SuggestedTitle == "" {
+		return sql.ErrNoRows
+	}
+
+	k.Title = k.SuggestedTitle
+	k.SuggestedTitle = ""
+	if err := s.repo.Update(*k); err != nil {
+		return err
+	}
+	s.invalidateAnswers(id)
+	return nil
+}
+
 func (s *service) Delete(id int) error {
-	return s.repo.Delete(id)
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.invalidateAnswers(id)
+	return nil
+}
+
+func (s *service) SearchSimilar(ctx context.Context, orgID int64, query string, limit int) ([]Knowledge, error) {
+	ctx = s.withRedaction(ctx, orgID)
+
+	// Embedding生成に失敗した場合はテキスト検索のみ行う
+	embedding, _ := ai.GenerateEmbedding(ctx, query)
+	return s.search(query, embedding, limit)
 }
 
-func (s *service) SearchSimilar(ctx context.Context, query string, limit int) ([]Knowledge, error) {
+// search runs embedding search when an embedding is given, falling back to full-text search
+func (s *service) search(query string, embedding []float32, limit int) ([]Knowledge, error) {
+	terms := QueryTerms(query)
+
 	// 1. まずEmbedding検索を試す
-	embedding, err := ai.GenerateEmbedding(ctx, query)
-	if err == nil {
+	if embedding != nil {
 		embeddingResults, _ := s.repo.SearchSimilar(embedding, limit)
 		if len(embeddingResults) > 0 {
-			return embeddingResults, nil
+			return withSnippets(embeddingResults, terms), nil
 		}
 	}
 
@@ -94,10 +231,24 @@ func (s *service) SearchSimilar(ctx context.Context, query string, limit int) ([
 		return nil, fmt.Errorf("both embedding and text search failed: %w", err)
 	}
 
-	return textResults, nil
+	return withSnippets(textResults, terms), nil
+}
+
+// ReindexSearch builds the full-text index for entries that do not have one yet
+func (s *service) ReindexSearch() (int, error) {
+	return s.repo.ReindexMissing()
+}
+
+// withSnippets sets a highlighted excerpt of the content on each result
+func withSnippets(results []Knowledge, terms []string) []Knowledge {
+	for i := range results {
+		results[i].Snippet = highlightSnippet(results[i].Content, terms)
+	}
+	return results
 }
 
-func (s *service) RegenerateEmbedding(ctx context.Context, id int, content string) error {
+func (s *service) RegenerateEmbedding(ctx context.Context, orgID int64, id int, content string) error {
+	ctx = s.withRedaction(ctx, orgID)
 	// Generate new embedding
 	embedding, err := ai.GenerateEmbedding(ctx, content)
 	if err != nil {
@@ -116,3 +267,56 @@ func (s *service) RegenerateEmbedding(ctx context.Context, id int, content strin
 
 	return nil
 }
+
+// GenerateMetadata suggests a title, summary and keywords without saving anything
+// (used to prefill forms, e.g. when saving a Slack thread)
+func (s *service) GenerateMetadata(ctx context.Context, orgID int64, title, content string) (*ai.Metadata, error) {
+	return ai.GenerateMetadata(s.withRedaction(ctx, orgID), title, content)
+}
+
+// fillMetadata generates suggestions and fills in the fields the author left empty.
+// Author-provided summary and keywords always take precedence; the title is never
+// overwritten, only stored as a suggestion.
+func (s *service) fillMetadata(ctx context.Context, k *Knowledge) {
+	meta, err := ai.GenerateMetadata(ctx, k.Title, k.Content)
+	if err != nil {
+		log.Printf("Failed to generate metadata: %v", err)
+		return
+	}
+
+	if k.Summary == "" {
+		k.Summary = meta.Summary
+	}
+	if len(k.Keywords) == 0 {
+		k.Keywords = meta.Keywords
+	}
+	if meta.Title != "" {
+		// 現在のタイトルと同じ案は保存時に取り除かれる
+		k.SuggestedTitle = meta.Title
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// detectInjection flags entries that look like they try to hijack the answer prompt
+func detectInjection(k Knowledge) []string {
+	flags := security.DetectPromptInjection(k.Title + "\n" + k.Content)
+	if len(flags) > 0 {
+		security.LogSecurityEvent("prompt_injection_in_knowledge", map[string]interface{}{
+			"knowledge_id": k.ID,
+			"created_by":   k.CreatedBy,
+			"flags":        flags,
+		})
+	}
+	return flags
+}
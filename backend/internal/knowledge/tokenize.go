@@ -0,0 +1,249 @@
+package knowledge
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 日本語は単語の区切りがないため、全文検索では文字種ごとの連続（ラン）に分割し、
+// 漢字・カタカナなどのCJKランは bi-gram（1文字のランは uni-gram）に分解して索引する。
+// 英数字のランはそのまま1語として扱う。
+
+type runKind int
+
+const (
+	runNone runKind = iota
+	runLatin
+	runHiragana
+	runKatakana
+	runHan
+	runOther
+)
+
+// textRun は同じ文字種が連続した部分文字列
+type textRun struct {
+	text string
+	kind runKind
+}
+
+// normalizeText は全角英数字・半角カナなどを NFKC で正規化し小文字化する
+func normalizeText(s string) string {
+	return strings.ToLower(norm.NFKC.String(s))
+}
+
+func classify(r rune) runKind {
+	switch {
+	case unicode.Is(unicode.Hiragana, r):
+		return runHiragana
+	case unicode.Is(unicode.Katakana, r), r == 'ー':
+		return runKatakana
+	case unicode.Is(unicode.Han, r), r == '々':
+		return runHan
+	case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		return runLatin
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		return runOther
+	default:
+		return runNone
+	}
+}
+
+// splitRuns は正規化済みテキストを文字種ごとのランに分割する
+func splitRuns(s string) []textRun {
+	var runs []textRun
+	var current []rune
+	kind := runNone
+
+	flush := func() {
+		if len(current) > 0 && kind != runNone {
+			runs = append(runs, textRun{text: string(current), kind: kind})
+		}
+		current = current[:0]
+	}
+
+	for _, r := range s {
+		k := classify(r)
+		if k != kind {
+			flush()
+			kind = k
+		}
+		if k != runNone {
+			current = append(current, r)
+		}
+	}
+	flush()
+	return runs
+}
+
+// ngrams は CJK ランを bi-gram に分解する（1文字の場合はそのまま）
+func ngrams(run textRun) []string {
+	if run.kind == runLatin {
+		return []string{run.text}
+	}
+	runes := []rune(run.text)
+	if len(runes) == 1 {
+		return []string{run.text}
+	}
+	grams := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
+
+// IndexTokens はテキストを索引用のトークン列（空白区切り）に変換する
+func IndexTokens(texts ...string) string {
+	var tokens []string
+	for _, text := range texts {
+		for _, run := range splitRuns(normalizeText(text)) {
+			tokens = append(tokens, ngrams(run)...)
+			// 1文字の検索語に一致させるため、CJKランは uni-gram も索引する
+			if run.kind != runLatin && len([]rune(run.text)) > 1 {
+				for _, r := range run.text {
+					tokens = append(tokens, string(r))
+				}
+			}
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// QueryTerms は検索クエリを検索語に分割する。
+// 「の」「は」などのひらがなランは助詞・送り仮名とみなして区切りとして扱う。
+func QueryTerms(query string) []string {
+	runs := splitRuns(normalizeText(query))
+
+	var terms []string
+	seen := map[string]bool{}
+	for _, run := range runs {
+		if run.kind == runHiragana {
+			continue
+		}
+		if !seen[run.text] {
+			seen[run.text] = true
+			terms = append(terms, run.text)
+		}
+	}
+
+	// ひらがなだけのクエリはそのまま検索語にする
+	if len(terms) == 0 {
+		for _, run := range runs {
+			if !seen[run.text] {
+				seen[run.text] = true
+				terms = append(terms, run.text)
+			}
+		}
+	}
+	return terms
+}
+
+// ContainsTerm は text に term が語として含まれるかを返す。一致箇所の前後が term の端と同じ文字種なら
+// 語の途中とみなす（"go" は "google" に、"経費" は "経費精算" に一致しない。"経費の精算" には一致する）
+func ContainsTerm(text, term string) bool {
+	text, term = normalizeText(text), normalizeText(strings.TrimSpace(term))
+	if term == "" {
+		return false
+	}
+	runes := []rune(term)
+	first, last := classify(runes[0]), classify(runes[len(runes)-1])
+
+	for i := 0; i < len(text); {
+		j := strings.Index(text[i:], term)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(term)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || first == runNone || classify(before) != first) &&
+			(end == len(text) || last == runNone || classify(after) != last) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		i = start + size
+	}
+	return false
+}
+
+// buildTSQuery は検索語ごとの n-gram を AND で、検索語同士を OR で結合した
+// to_tsquery('simple', ...) 用の式を作る。一致した検索語が多いほどランクが高くなる。
+func buildTSQuery(terms []string) string {
+	var clauses []string
+	for _, term := range terms {
+		kind := classify([]rune(term)[0])
+		grams := ngrams(textRun{text: term, kind: kind})
+		quoted := make([]string, len(grams))
+		for i, g := range grams {
+			quoted[i] = fmt.Sprintf("'%s'", strings.ReplaceAll(g, "'", "''"))
+		}
+		clauses = append(clauses, "("+strings.Join(quoted, " & ")+")")
+	}
+	return strings.Join(clauses, " | ")
+}
+
+const (
+	snippetRadius  = 40
+	highlightOpen  = "**"
+	highlightClose = "**"
+)
+
+// highlightSnippet は最初に一致した検索語の周辺を切り出し、一致箇所を強調する
+func highlightSnippet(content string, terms []string) string {
+	runes := []rune(norm.NFKC.String(content))
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) || len(terms) == 0 {
+		return ""
+	}
+
+	// 一致位置を収集
+	matched := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != term {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				matched[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+	if first == -1 {
+		return ""
+	}
+
+	start := first - snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := first + snippetRadius
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	for i := start; i < end; i++ {
+		if matched[i] && (i == start || !matched[i-1]) {
+			b.WriteString(highlightOpen)
+		}
+		b.WriteRune(runes[i])
+		if matched[i] && (i == end-1 || !matched[i+1]) {
+			b.WriteString(highlightClose)
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
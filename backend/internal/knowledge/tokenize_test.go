@@ -0,0 +1,99 @@
+package knowledge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  string
+	}{
+		{"kanji bigrams and unigrams", []string{"東京都"}, "東京 京都 東 京 都"},
+		{"single kanji", []string{"炎"}, "炎"},
+		{"latin and kanji runs", []string{"Slack連携"}, "slack 連携 連 携"},
+		{"full-width latin and katakana", []string{"ＡＰＩキー"}, "api キー キ ー"},
+		{"punctuation splits runs", []string{"VPN、設定!"}, "vpn 設定 設 定"},
+		{"multiple texts", []string{"Go", "言語"}, "go 言語 言 語"},
+		{"empty", []string{""}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IndexTokens(tt.texts...); got != tt.want {
+				t.Errorf("IndexTokens(%q) = %q, want %q", tt.texts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"drops hiragana particles", "経費精算の締め日は？", []string{"経費精算", "締", "日"}},
+		{"hiragana only query is kept", "すし", []string{"すし"}},
+		{"normalizes and deduplicates", "VPN ｖｐｎ vpn", []string{"vpn"}},
+		{"mixed scripts", "Slackで通知", []string{"slack", "通知"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryTerms(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms []string
+		want  string
+	}{
+		{"ngrams are ANDed", []string{"経費精算"}, "('経費' & '費精' & '精算')"},
+		{"terms are ORed", []string{"経費精算", "日"}, "('経費' & '費精' & '精算') | ('日')"},
+		{"latin term is one lexeme", []string{"vpn"}, "('vpn')"},
+		{"quotes are escaped", []string{"o'reilly"}, "('o''reilly')"},
+		{"no terms", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildTSQuery(tt.terms); got != tt.want {
+				t.Errorf("buildTSQuery(%q) = %q, want %q", tt.terms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainsTerm(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		term string
+		want bool
+	}{
+		{"latin word", "Go の使い方", "go", true},
+		{"latin inside a word", "google の使い方", "go", false},
+		{"latin followed by kanji", "VPNに接続できない", "vpn", true},
+		{"full-width text", "ＧＯで書く", "Go", true},
+		{"later occurrence on a boundary", "golang と go", "go", true},
+		{"kanji separated by hiragana", "経費の精算", "経費", true},
+		{"kanji inside a kanji run", "経費精算の締め日", "経費", false},
+		{"katakana after kanji", "新人エンジニア", "エンジニア", true},
+		{"symbols at the edges", "c++ の書き方", "c++", true},
+		{"empty term", "go", " ", false},
+		{"not contained", "経費精算", "人事", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainsTerm(tt.text, tt.term); got != tt.want {
+				t.Errorf("ContainsTerm(%q, %q) = %v, want %v", tt.text, tt.term, got, tt.want)
+			}
+		})
+	}
+}
@@ -92,12 +92,28 @@ func (em *EmailMonitor) LogEmailEvent(ctx context.Context, event EmailEvent) {
 	em.cleanupOldEvents()
 }
 
-// GetMetrics は現在のメトリクスを取得
-func (em *EmailMonitor) GetMetrics() EmailMetrics {
+// GetMetrics は現在のメトリクスのスナップショットを取得
+func (em *EmailMonitor) GetMetrics() *EmailMetrics {
 	em.metrics.mu.RLock()
 	defer em.metrics.mu.RUnlock()
 
-	return em.metrics
+	snapshot := &EmailMetrics{
+		TotalSent:      em.metrics.TotalSent,
+		TotalFailed:    em.metrics.TotalFailed,
+		SuccessRate:    em.metrics.SuccessRate,
+		AverageLatency: em.metrics.AverageLatency,
+		Last24Hours:    em.metrics.Last24Hours,
+		LastHour:       em.metrics.LastHour,
+		ErrorsByType:   make(map[string]int64, len(em.metrics.ErrorsByType)),
+		EmailsByDomain: make(map[string]int64, len(em.metrics.EmailsByDomain)),
+	}
+	for k, v := range em.metrics.ErrorsByType {
+		snapshot.ErrorsByType[k] = v
+	}
+	for k, v := range em.metrics.EmailsByDomain {
+		snapshot.EmailsByDomain[k] = v
+	}
+	return snapshot
 }
 
 // GetRecentEvents は最近のイベントを取得
@@ -0,0 +1,48 @@
+package security
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// injectionPattern はプロンプトインジェクションの典型的な言い回し
+type injectionPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var injectionPatterns = []injectionPattern{
+	{"ignore_instructions", regexp.MustCompile(`(?i)(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(the\s+)?(previous|prior|above|earlier|preceding)\s+(instructions?|prompts?|rules?|context)`)},
+	{"ignore_instructions", regexp.MustCompile(`(これまで|以前|前|上記|先ほど|今まで)の(指示|命令|ルール|制約|プロンプト)を(すべて|全て)?(無視|忘れ|破棄)`)},
+	{"role_override", regexp.MustCompile(`(?i)(you\s+are\s+now|from\s+now\s+on,?\s+you|act\s+as\s+(an?\s+)?(unrestricted|jailbroken)|developer\s+mode)`)},
+	{"role_override", regexp.MustCompile(`(あなたは|お前は)(今から|これから|今後)`)},
+	{"prompt_exfiltration", regexp.MustCompile(`(?i)(reveal|show|print|repeat|output)\s+(me\s+)?(your|the)\s+(system\s+prompt|instructions|hidden\s+prompt)`)},
+	{"prompt_exfiltration", regexp.MustCompile(`(システムプロンプト|指示文|内部の?指示)を(教え|表示|出力|見せ)`)},
+	{"role_marker", regexp.MustCompile(`(?i)(<\|im_start\|>|<\|im_end\|>|<\|system\|>|^\s*(system|assistant)\s*:|\[/?(system|inst)\]|###\s*(system|instruction))`)},
+	{"delimiter_escape", regexp.MustCompile(`(?i)</?\s*(document|knowledge|question|context)\b[^>]*>`)},
+}
+
+// DetectPromptInjection は text に含まれるプロンプトインジェクションの疑いがある
+// パターン名を返す（重複なし）。疑いがなければ nil を返す。
+func DetectPromptInjection(text string) []string {
+	normalized := norm.NFKC.String(text)
+	lines := strings.Split(normalized, "\n")
+
+	var found []string
+	seen := map[string]bool{}
+	for _, p := range injectionPatterns {
+		if seen[p.name] {
+			continue
+		}
+		for _, line := range lines {
+			if p.re.MatchString(line) {
+				seen[p.name] = true
+				found = append(found, p.name)
+				break
+			}
+		}
+	}
+	return found
+}
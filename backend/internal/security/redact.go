@@ -0,0 +1,210 @@
+package security
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactionRule は外部AIへ送信する前に伏せ字にするパターン
+type RedactionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Restore が true の場合、AIの出力に含まれるプレースホルダを元の値に戻す
+	Restore bool
+	// validate が設定されている場合、一致した文字列のうち true を返すものだけを伏せ字にする
+	validate func(string) bool
+}
+
+// 組み込みルール名
+const (
+	RedactEmail      = "email"
+	RedactPhone      = "phone"
+	RedactCreditCard = "credit_card"
+	RedactAPIKey     = "api_key"
+)
+
+// DefaultRedactionRules は組み込みルール名の既定値。
+// 番号同士の誤検出を避けるため、適用はこの順序で行う。
+var DefaultRedactionRules = []string{RedactAPIKey, RedactCreditCard, RedactEmail, RedactPhone}
+
+var builtinRedactionRules = map[string]RedactionRule{
+	RedactEmail: {
+		Name:    RedactEmail,
+		Pattern: regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`),
+		Restore: true,
+	},
+	RedactPhone: {
+		Name:    RedactPhone,
+		Pattern: regexp.MustCompile(`(\+81[\-\s]?|\b0)\d{1,4}[\-\s]?\d{1,4}[\-\s]?\d{3,4}\b`),
+		Restore: true,
+		validate: func(s string) bool {
+			n := countDigits(s)
+			return n >= 10 && n <= 12
+		},
+	},
+	RedactCreditCard: {
+		Name:     RedactCreditCard,
+		Pattern:  regexp.MustCompile(`\b\d(?:[\-\s]?\d){12,18}\b`),
+		validate: luhnValid,
+	},
+	RedactAPIKey: {
+		Name: RedactAPIKey,
+		Pattern: regexp.MustCompile(`\b(sk-[A-Za-z0-9_\-]{16,}|xox[abposr]-[A-Za-z0-9\-]{10,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{30,}|AIza[0-9A-Za-z_\-]{35})\b|` +
+			`(?i)\b(api[_\-]?key|secret|token|password)\s*[:=]\s*\S{8,}`),
+	},
+}
+
+// Redactor は設定されたルールで文字列を伏せ字にする
+type Redactor struct {
+	rules []RedactionRule
+}
+
+// NewRedactor は組み込みルール名と独自ルールから Redactor を作る。
+// 未知の組み込みルール名はエラーになる。
+func NewRedactor(builtins []string, custom ...RedactionRule) (*Redactor, error) {
+	enabled := map[string]bool{}
+	for _, name := range builtins {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := builtinRedactionRules[name]; !ok {
+			return nil, fmt.Errorf("unknown redaction rule: %s", name)
+		}
+		enabled[name] = true
+	}
+
+	// 独自ルールは組み込みより先に適用する（より具体的なパターンを優先）
+	rules := append([]RedactionRule{}, custom...)
+	for _, name := range DefaultRedactionRules {
+		if enabled[name] {
+			rules = append(rules, builtinRedactionRules[name])
+		}
+	}
+	return &Redactor{rules: rules}, nil
+}
+
+// CompileRedactionRule は独自ルールの正規表現をコンパイルする
+func CompileRedactionRule(name, pattern string, restore bool) (RedactionRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RedactionRule{}, fmt.Errorf("invalid redaction pattern %q: %w", name, err)
+	}
+	return RedactionRule{Name: name, Pattern: re, Restore: restore}, nil
+}
+
+// NewSession は1回のAI呼び出し用のセッションを作る。
+// 同じセッション内では同じ値に同じプレースホルダが割り当てられる。
+func (r *Redactor) NewSession() *RedactionSession {
+	return &RedactionSession{
+		redactor: r,
+		byValue:  map[string]string{},
+		entries:  map[string]redactedValue{},
+		counts:   map[string]int{},
+		serial:   map[string]int{},
+	}
+}
+
+type redactedValue struct {
+	original string
+	restore  bool
+}
+
+// RedactionSession は伏せ字とプレースホルダの対応を保持する
+type RedactionSession struct {
+	redactor *Redactor
+	byValue  map[string]string
+	entries  map[string]redactedValue
+	counts   map[string]int
+	serial   map[string]int
+}
+
+// Redact は text 中の一致箇所を [EMAIL_1] のようなプレースホルダに置き換える
+func (s *RedactionSession) Redact(text string) string {
+	if s == nil || s.redactor == nil {
+		return text
+	}
+	for _, rule := range s.redactor.rules {
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.validate != nil && !rule.validate(match) {
+				return match
+			}
+			s.counts[rule.Name]++
+			if placeholder, ok := s.byValue[match]; ok {
+				return placeholder
+			}
+			s.serial[rule.Name]++
+			placeholder := fmt.Sprintf("[%s_%d]", strings.ToUpper(rule.Name), s.serial[rule.Name])
+			s.byValue[match] = placeholder
+			s.entries[placeholder] = redactedValue{original: match, restore: rule.Restore}
+			return placeholder
+		})
+	}
+	return text
+}
+
+// Restore は復元が許可されたプレースホルダを元の値に戻す
+func (s *RedactionSession) Restore(text string) string {
+	if s == nil {
+		return text
+	}
+	for placeholder, v := range s.entries {
+		if v.restore {
+			text = strings.ReplaceAll(text, placeholder, v.original)
+		}
+	}
+	return text
+}
+
+// Counts はルール別の伏せ字件数を返す
+func (s *RedactionSession) Counts() map[string]int {
+	if s == nil {
+		return nil
+	}
+	return s.counts
+}
+
+// Total は伏せ字にした件数の合計を返す
+func (s *RedactionSession) Total() int {
+	total := 0
+	for _, n := range s.Counts() {
+		total += n
+	}
+	return total
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// luhnValid はクレジットカード番号のチェックサムを検証する
+func luhnValid(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
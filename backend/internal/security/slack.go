@@ -0,0 +1,36 @@
+package security
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// slackSigningSecretPattern は Slack の署名シークレット（16進文字列）の形式
+var slackSigningSecretPattern = regexp.MustCompile(`^[0-9a-fA-F]{32,}$`)
+
+// SlackSigningSecrets は有効な署名シークレットを返す。
+// ローテーション中は SLACK_SIGNING_SECRETS に新旧をカンマ区切りで指定し、SLACK_SIGNING_SECRET も併せて受け付ける
+func SlackSigningSecrets() []string {
+	var secrets []string
+	seen := map[string]bool{}
+	for _, s := range append(strings.Split(os.Getenv("SLACK_SIGNING_SECRETS"), ","), os.Getenv("SLACK_SIGNING_SECRET")) {
+		if s = strings.TrimSpace(s); s != "" && !seen[s] {
+			seen[s] = true
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// SlackVerificationDisabled は署名検証を省略する開発モードかどうか。
+// SLACK_SKIP_VERIFICATION=true かつ ENVIRONMENT=development が明示的に設定されている場合のみ有効
+// （ENVIRONMENT が未設定なら本番とみなし、検証を省略しない）
+func SlackVerificationDisabled() bool {
+	return os.Getenv("SLACK_SKIP_VERIFICATION") == "true" && os.Getenv("ENVIRONMENT") == "development"
+}
+
+// validSlackSigningSecret は署名シークレットの形式を確認する
+func validSlackSigningSecret(secret string) bool {
+	return slackSigningSecretPattern.MatchString(secret)
+}
@@ -39,14 +39,25 @@ func ValidateSecurityConfig() (*SecurityConfig, error) {
 	}
 	config.JWTSecret = jwtSecret
 
-	// Slack署名秘密鍵の検証
-	slackSecret := getEnv("SLACK_SIGNING_SECRET", "")
-	if slackSecret == "" {
-		errors = append(errors, "SLACK_SIGNING_SECRET is required")
-	} else if !strings.HasPrefix(slackSecret, "xoxb-") && !strings.HasPrefix(slackSecret, "xoxp-") {
-		errors = append(errors, "SLACK_SIGNING_SECRET appears to be invalid format")
-	}
-	config.SlackSecret = slackSecret
+	// Slack署名秘密鍵の検証（開発モードで検証を省略する場合を除き必須）
+	slackSecrets := SlackSigningSecrets()
+	if len(slackSecrets) == 0 {
+		if !SlackVerificationDisabled() {
+			errors = append(errors, "SLACK_SIGNING_SECRET or SLACK_SIGNING_SECRETS is required (set SLACK_SKIP_VERIFICATION=true only in development)")
+		}
+	} else {
+		for _, s := range slackSecrets {
+			if !validSlackSigningSecret(s) {
+				errors = append(errors, "Slack signing secret appears to be invalid format")
+				break
+			}
+		}
+		config.SlackSecret = slackSecrets[0]
+	}
+	// Environment は未設定時に development になるため、環境変数が明示的に設定されているかを見る
+	if os.Getenv("ENVIRONMENT") != "development" && os.Getenv("SLACK_SKIP_VERIFICATION") == "true" {
+		errors = append(errors, "SLACK_SKIP_VERIFICATION is only allowed when ENVIRONMENT=development is set explicitly")
+	}
 
 	// OpenAI APIキーの検証
 	openAIKey := getEnv("OPENAI_API_KEY", "")
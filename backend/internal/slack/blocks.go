@@ -0,0 +1,201 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"slack-bot/backend/internal/knowledge"
+)
+
+// 回答メッセージのボタンの action_id
+const (
+	actionAnswerHelpful    = "answer_helpful"
+	actionAnswerNotHelpful = "answer_not_helpful"
+	actionAnswerShare      = "answer_share"
+)
+
+// maxSourceLinks は回答に添える根拠ナレッジの件数
+const maxSourceLinks = 3
+
+// maxButtonValue は Slack のボタン value の上限文字数
+const maxButtonValue = 2000
+
+// answerRef はボタンの value に埋め込む回答の情報。
+// 本人にのみ見える回答はボタン押下時に本文を受け取れないため、共有用に回答と根拠も持たせる
+type answerRef struct {
+	Question     string         `json:"q"`
+	Answer       string         `json:"a,omitempty"`
+	KnowledgeIDs []int          `json:"ids,omitempty"`
+	Sources      []answerSource `json:"s,omitempty"`
+}
+
+// answerSource は回答に表示する根拠ナレッジ
+type answerSource struct {
+	ID    int    `json:"i"`
+	Title string `json:"t"`
+}
+
+// webAppURL は Web アプリのベースURL（ナレッジへのリンクに使う）
+func webAppURL() string {
+	if u := os.Getenv("WEB_APP_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// knowledgeURL は Web アプリ上のナレッジのURL
+func knowledgeURL(id int) string {
+	return fmt.Sprintf("%s/knowledge/knowledge-resister/%d", webAppURL(), id)
+}
+
+// confidenceLabel は最上位の検索結果の類似度を表示用のラベルにする。
+// 全文検索の ts_rank は類似度と尺度が異なるため、ベクトル検索の結果でなければ一致度を出さない
+func confidenceLabel(related []knowledge.Knowledge) string {
+	if len(related) == 0 {
+		return "なし"
+	}
+	switch score := related[0].Similarity; {
+	case score <= 0:
+		return "—（キーワード一致）"
+	case score >= 0.8:
+		return fmt.Sprintf("高（%.0f%%）", score*100)
+	case score >= 0.6:
+		return fmt.Sprintf("中（%.0f%%）", score*100)
+	default:
+		return fmt.Sprintf("低（%.0f%%）", score*100)
+	}
+}
+
+// buildAnswerBlocks は回答・根拠ナレッジ・一致度・操作ボタンの Block Kit を組み立てる。
+// shareable が true の場合は「チャンネルに共有」ボタンを含める（本人にのみ見える回答向け）
+func buildAnswerBlocks(question string, result *knowledge.AskResult, shareable bool) []map[string]any {
+	blocks := []map[string]any{
+		{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": formatAnswer(result)},
+		},
+	}
+
+	ref := newAnswerRef(question, result)
+	if len(ref.Sources) > 0 {
+		blocks = append(blocks, sourcesBlock(ref.Sources))
+	}
+
+	blocks = append(blocks, map[string]any{
+		"type": "context",
+		"elements": []map[string]any{
+			{"type": "mrkdwn", "text": fmt.Sprintf("質問: %s ｜ 一致度: %s", escapeMrkdwn(question), confidenceLabel(result.Related))},
+		},
+	})
+
+	value := ref.value()
+	buttons := []map[string]any{
+		button(actionAnswerHelpful, ":+1: 役に立った", value, ""),
+		button(actionAnswerNotHelpful, ":-1: 役に立たなかった", value, ""),
+	}
+	if shareable {
+		buttons = append(buttons, button(actionAnswerShare, "チャンネルに共有", value, "primary"))
+	}
+	blocks = append(blocks, map[string]any{
+		"type":     "actions",
+		"elements": buttons,
+	})
+
+	return blocks
+}
+
+func button(actionID, text, value, style string) map[string]any {
+	b := map[string]any{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]any{"type": "plain_text", "text": text, "emoji": true},
+		"value":     value,
+	}
+	if style != "" {
+		b["style"] = style
+	}
+	return b
+}
+
+// buildSharedAnswerBlocks はチャンネルに共有する回答の Block Kit を組み立てる
+func buildSharedAnswerBlocks(ref answerRef, sharedBy string) []map[string]any {
+	blocks := []map[string]any{
+		{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": ref.Answer},
+		},
+	}
+	if len(ref.Sources) > 0 {
+		blocks = append(blocks, sourcesBlock(ref.Sources))
+	}
+	return append(blocks, map[string]any{
+		"type": "context",
+		"elements": []map[string]any{
+			{"type": "mrkdwn", "text": fmt.Sprintf("質問: %s ｜ <@%s> が共有しました", escapeMrkdwn(ref.Question), sharedBy)},
+		},
+	})
+}
+
+func sourcesBlock(sources []answerSource) map[string]any {
+	var b strings.Builder
+	b.WriteString("*参照したナレッジ*\n")
+	for _, src := range sources {
+		fmt.Fprintf(&b, "• <%s|%s>\n", knowledgeURL(src.ID), escapeMrkdwn(src.Title))
+	}
+	return map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": strings.TrimRight(b.String(), "\n")},
+	}
+}
+
+func newAnswerRef(question string, result *knowledge.AskResult) answerRef {
+	ref := answerRef{Question: question, Answer: formatAnswer(result)}
+	for i, k := range result.Related {
+		ref.KnowledgeIDs = append(ref.KnowledgeIDs, k.ID)
+		if i < maxSourceLinks {
+			ref.Sources = append(ref.Sources, answerSource{ID: k.ID, Title: k.Title})
+		}
+	}
+	return ref
+}
+
+// value はボタンの value の上限に収まるよう、質問・根拠のタイトル・回答の順に切り詰めた JSON を返す
+func (ref answerRef) value() string {
+	for {
+		b, _ := json.Marshal(ref)
+		if len(b) <= maxButtonValue {
+			return string(b)
+		}
+		switch {
+		case len([]rune(ref.Question)) > 50:
+			ref.Question = truncateRunes(ref.Question, 50)
+		case len(ref.Sources) > 0:
+			ref.Sources = ref.Sources[:len(ref.Sources)-1]
+		default:
+			runes := []rune(ref.Answer)
+			ref.Answer = string(runes[:len(runes)*3/4])
+		}
+	}
+}
+
+// parseAnswerRef はボタンの value を読み出す
+func parseAnswerRef(value string) (answerRef, error) {
+	var ref answerRef
+	err := json.Unmarshal([]byte(value), &ref)
+	return ref, err
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// escapeMrkdwn は mrkdwn の制御文字をエスケープする
+func escapeMrkdwn(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
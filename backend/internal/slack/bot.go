@@ -1,8 +1,19 @@
 package slack
 
-import "log"
+import (
+	"context"
+	"time"
+)
 
-func SendDM(slackID, text string) error {
-	log.Printf("[DEV] DM to %s: %s", slackID, text)
-	return nil
+// SendDM は組織のワークスペースの Bot からユーザーにDMを送る。
+// 組織にワークスペースがない（Bot トークンがない）場合は送信せずに ErrNotInstalled を返す（本文はログにも出さない）
+func SendDM(ctx context.Context, orgID int64, slackID, text string) error {
+	ws, err := workspaceForOrg(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return ws.Client.SendDM(ctx, slackID, text)
 }
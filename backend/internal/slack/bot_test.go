@@ -0,0 +1,80 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSendDM(t *testing.T) {
+	const code = "Slack アカウント連携の確認コード: *123456*"
+
+	tests := []struct {
+		name       string
+		token      string
+		teamID     string
+		defaultOrg int64
+		orgID      int64
+		wantErr    error
+		wantCalls  int32
+	}{
+		{name: "no bot token", teamID: "T1", defaultOrg: 1, orgID: 1, wantErr: ErrNotInstalled},
+		{name: "organization without a workspace", token: "xoxb-default", teamID: "T1", defaultOrg: 1, orgID: 2, wantErr: ErrNotInstalled},
+		{name: "default workspace of the organization", token: "xoxb-default", teamID: "T1", defaultOrg: 1, orgID: 1, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			var gotAuth, gotBody string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				gotAuth = r.Header.Get("Authorization")
+				if r.URL.Path == "/conversations.open" {
+					w.Write([]byte(`{"ok":true,"channel":{"id":"D1"}}`))
+					return
+				}
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				w.Write([]byte(`{"ok":true,"ts":"1.0"}`))
+			}))
+			defer srv.Close()
+			t.Setenv("SLACK_API_BASE_URL", srv.URL)
+			t.Setenv("SLACK_BOT_TOKEN", tt.token)
+
+			origOpts, origInst := slackOptions, installations
+			slackOptions, installations = Options{DefaultTeamID: tt.teamID, DefaultOrgID: tt.defaultOrg}, nil
+			defer func() { slackOptions, installations = origOpts, origInst }()
+
+			var logs bytes.Buffer
+			origLog := log.Writer()
+			log.SetOutput(&logs)
+			err := SendDM(context.Background(), tt.orgID, "U123", code)
+			log.SetOutput(origLog)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SendDM() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("Slack API calls = %d, want %d", got, tt.wantCalls)
+			}
+			if logs.Len() != 0 {
+				t.Errorf("SendDM logged %q, want nothing", logs.String())
+			}
+			if tt.wantCalls > 0 {
+				if gotAuth != "Bearer "+tt.token {
+					t.Errorf("Authorization = %q, want Bearer %s", gotAuth, tt.token)
+				}
+				if !strings.Contains(gotBody, "123456") {
+					t.Errorf("chat.postMessage body = %s, want the code", gotBody)
+				}
+			}
+		})
+	}
+}
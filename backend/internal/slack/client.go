@@ -0,0 +1,395 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIBaseURL は Slack Web API のベースURL
+const DefaultAPIBaseURL = "https://slack.com/api/"
+
+const (
+	defaultMaxRetries = 3
+	// maxRetryAfter を超える Retry-After は待たずにエラーにする
+	maxRetryAfter = 30 * time.Second
+)
+
+// retryAfter はレート制限時に待つタイマー（テストで置き換える）
+var retryAfter = time.After
+
+// ErrNoToken は Bot トークンが設定されていないことを表す
+var ErrNoToken = errors.New("slack bot token is not configured")
+
+// APIError は Slack が ok:false を返したことを表す（Code は "channel_not_found" など）
+type APIError struct {
+	Method string
+	Code   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack %s: %s", e.Method, e.Code)
+}
+
+// RateLimitedError は再試行してもレート制限が解除されなかったことを表す
+type RateLimitedError struct {
+	Method     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("slack %s: rate limited (retry after %s)", e.Method, e.RetryAfter)
+}
+
+// ErrorCode は Slack のエラーコードを返す（APIError でなければ空）
+func ErrorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// ClientOptions は Client の設定
+type ClientOptions struct {
+	// BaseURL を指定するとローカルのスタブなどに接続できる（既定は DefaultAPIBaseURL）
+	BaseURL string
+	// HTTPClient を指定しない場合はタイムアウト10秒のクライアントを使う
+	HTTPClient *http.Client
+	// MaxRetries はレート制限時の再試行回数（0 は既定値）
+	MaxRetries int
+}
+
+// Client は Bot トークンで Slack Web API を呼び出す
+type Client struct {
+	token      string
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+}
+
+// NewClient は Bot トークンを使うクライアントを作る
+func NewClient(token string, opts ClientOptions) *Client {
+	c := &Client{
+		token:      token,
+		baseURL:    opts.BaseURL,
+		httpClient: opts.HTTPClient,
+		maxRetries: opts.MaxRetries,
+	}
+	if c.baseURL == "" {
+		c.baseURL = DefaultAPIBaseURL
+	}
+	if !strings.HasSuffix(c.baseURL, "/") {
+		c.baseURL += "/"
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.maxRetries <= 0 {
+		c.maxRetries = defaultMaxRetries
+	}
+	return c
+}
+
+// DefaultClient は環境変数 SLACK_BOT_TOKEN・SLACK_API_BASE_URL のクライアントを返す
+func DefaultClient() *Client {
+	return tokenClient(os.Getenv("SLACK_BOT_TOKEN"))
+}
+
+// tokenClient は指定した Bot トークンで SLACK_API_BASE_URL に接続するクライアントを返す
+func tokenClient(token string) *Client {
+	return NewClient(token, ClientOptions{BaseURL: os.Getenv("SLACK_API_BASE_URL")})
+}
+
+// call は Web API のメソッドを呼び出し、レスポンスを out に読み込む。
+// 参照系のメソッドは JSON ボディを受け付けないため url.Values はフォームで送る
+func (c *Client) call(ctx context.Context, method string, body any, out any) error {
+	if c.token == "" {
+		return ErrNoToken
+	}
+	return c.send(ctx, method, body, out)
+}
+
+// send はトークンの有無を確認せずに呼び出す（oauth.v2.access など、トークン取得前に使うメソッド用）
+func (c *Client) send(ctx context.Context, method string, body any, out any) error {
+	contentType := "application/json; charset=utf-8"
+	var payload []byte
+	if form, ok := body.(url.Values); ok {
+		contentType = "application/x-www-form-urlencoded"
+		payload = []byte(form.Encode())
+	} else {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.do(ctx, method, contentType, payload, out)
+		if wait == 0 {
+			return err
+		}
+		if attempt >= c.maxRetries || wait > maxRetryAfter {
+			return &RateLimitedError{Method: method, RetryAfter: wait}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-retryAfter(wait):
+		}
+	}
+}
+
+// do は1回分のリクエストを送る。レート制限された場合は待つべき時間を返す
+func (c *Client) do(ctx context.Context, method, contentType string, payload []byte, out any) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+method, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return parseRetryAfter(resp.Header.Get("Retry-After")), nil
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return 0, fmt.Errorf("slack %s: failed to decode response (status %d): %w", method, resp.StatusCode, err)
+	}
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, err
+	}
+	if !result.OK {
+		if result.Error == "ratelimited" {
+			return parseRetryAfter(resp.Header.Get("Retry-After")), nil
+		}
+		return 0, &APIError{Method: method, Code: result.Error}
+	}
+
+	if out != nil {
+		return 0, json.Unmarshal(raw, out)
+	}
+	return 0, nil
+}
+
+// parseRetryAfter は Retry-After（秒）を解釈する。不正な値は1秒とみなす
+func parseRetryAfter(v string) time.Duration {
+	sec, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || sec <= 0 {
+		return time.Second
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// Message は chat.postMessage / chat.update の内容
+type Message struct {
+	Channel string `json:"channel"`
+	Text    string `json:"text"`
+	// ThreadTS を指定するとスレッドに返信する
+	ThreadTS string `json:"thread_ts,omitempty"`
+	// Blocks を指定した場合、Text は通知用のフォールバックになる
+	Blocks []map[string]any `json:"blocks,omitempty"`
+}
+
+// PostMessage はメッセージを投稿し、その ts を返す
+func (c *Client) PostMessage(ctx context.Context, msg Message) (string, error) {
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	err := c.call(ctx, "chat.postMessage", msg, &resp)
+	return resp.TS, err
+}
+
+// UpdateMessage は投稿済みのメッセージを書き換える
+func (c *Client) UpdateMessage(ctx context.Context, ts string, msg Message) error {
+	return c.call(ctx, "chat.update", struct {
+		Message
+		TS string `json:"ts"`
+	}{msg, ts}, nil)
+}
+
+// OpenConversation はユーザーとのDMを開き、チャンネルIDを返す
+func (c *Client) OpenConversation(ctx context.Context, userID string) (string, error) {
+	var resp struct {
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+	}
+	err := c.call(ctx, "conversations.open", map[string]any{"users": userID}, &resp)
+	return resp.Channel.ID, err
+}
+
+// SendDM はユーザーにDMを送る
+func (c *Client) SendDM(ctx context.Context, userID, text string) error {
+	channel, err := c.OpenConversation(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = c.PostMessage(ctx, Message{Channel: channel, Text: text})
+	return err
+}
+
+// User は Slack のユーザー（使用する項目のみ）
+type User struct {
+	ID       string `json:"id"`
+	TeamID   string `json:"team_id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Deleted  bool   `json:"deleted"`
+	IsBot    bool   `json:"is_bot"`
+	TZ       string `json:"tz"`
+	Profile  struct {
+		Email       string `json:"email"`
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+	} `json:"profile"`
+}
+
+// DisplayName は表示名（未設定なら実名、ユーザー名）を返す
+func (u *User) DisplayName() string {
+	for _, name := range []string{u.Profile.DisplayName, u.Profile.RealName, u.RealName, u.Name} {
+		if name != "" {
+			return name
+		}
+	}
+	return u.ID
+}
+
+// UserInfo はユーザー情報を返す
+func (c *Client) UserInfo(ctx context.Context, userID string) (*User, error) {
+	var resp struct {
+		User User `json:"user"`
+	}
+	if err := c.call(ctx, "users.info", url.Values{"user": {userID}}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+// LookupUserByEmail はメールアドレスからユーザーを探す（見つからない場合は Code が users_not_found の APIError）
+func (c *Client) LookupUserByEmail(ctx context.Context, email string) (*User, error) {
+	var resp struct {
+		User User `json:"user"`
+	}
+	if err := c.call(ctx, "users.lookupByEmail", url.Values{"email": {email}}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+// OpenView はモーダルを開き、view ID を返す
+func (c *Client) OpenView(ctx context.Context, triggerID string, view map[string]any) (string, error) {
+	var resp struct {
+		View struct {
+			ID string `json:"id"`
+		} `json:"view"`
+	}
+	err := c.call(ctx, "views.open", map[string]any{"trigger_id": triggerID, "view": view}, &resp)
+	return resp.View.ID, err
+}
+
+// UpdateView は開いているモーダルの内容を置き換える
+func (c *Client) UpdateView(ctx context.Context, viewID string, view map[string]any) error {
+	return c.call(ctx, "views.update", map[string]any{"view_id": viewID, "view": view}, nil)
+}
+
+// PublishView はユーザーの App Home タブの内容を置き換える
+func (c *Client) PublishView(ctx context.Context, userID string, view map[string]any) error {
+	return c.call(ctx, "views.publish", map[string]any{"user_id": userID, "view": view}, nil)
+}
+
+// ThreadMessage はスレッド内のメッセージ
+type ThreadMessage struct {
+	User  string `json:"user"`
+	BotID string `json:"bot_id"`
+	Text  string `json:"text"`
+	TS    string `json:"ts"`
+}
+
+// ConversationReplies はスレッドの親メッセージと返信を古い順に返す
+func (c *Client) ConversationReplies(ctx context.Context, channel, threadTS string) ([]ThreadMessage, error) {
+	var messages []ThreadMessage
+	cursor := ""
+	for {
+		var resp struct {
+			Messages         []ThreadMessage `json:"messages"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		body := url.Values{"channel": {channel}, "ts": {threadTS}, "limit": {"200"}}
+		if cursor != "" {
+			body.Set("cursor", cursor)
+		}
+		if err := c.call(ctx, "conversations.replies", body, &resp); err != nil {
+			return nil, err
+		}
+		messages = append(messages, resp.Messages...)
+		if cursor = resp.ResponseMetadata.NextCursor; cursor == "" {
+			return messages, nil
+		}
+	}
+}
+
+// Permalink はメッセージのパーマリンクを返す
+func (c *Client) Permalink(ctx context.Context, channel, ts string) (string, error) {
+	var resp struct {
+		Permalink string `json:"permalink"`
+	}
+	err := c.call(ctx, "chat.getPermalink", url.Values{"channel": {channel}, "message_ts": {ts}}, &resp)
+	return resp.Permalink, err
+}
+
+// OAuthAccess は oauth.v2.access の結果（使用する項目のみ）
+type OAuthAccess struct {
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	BotUserID   string `json:"bot_user_id"`
+	Team        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"team"`
+	AuthedUser struct {
+		ID string `json:"id"`
+	} `json:"authed_user"`
+}
+
+// OAuthV2Access はインストール時の認可コードを Bot トークンに交換する（トークンなしのクライアントで呼ぶ）
+func (c *Client) OAuthV2Access(ctx context.Context, clientID, clientSecret, code, redirectURI string) (*OAuthAccess, error) {
+	body := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"code":          {code},
+	}
+	if redirectURI != "" {
+		body.Set("redirect_uri", redirectURI)
+	}
+	var resp OAuthAccess
+	if err := c.send(ctx, "oauth.v2.access", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,198 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubResponse は Slack API スタブが返す1回分のレスポンス
+type stubResponse struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+// newSlackStub は responses を順に返し（最後のものを繰り返す）、呼び出し回数を数えるスタブ
+func newSlackStub(t *testing.T, responses ...stubResponse) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		res := responses[min(n, len(responses))-1]
+		if res.retryAfter != "" {
+			w.Header().Set("Retry-After", res.retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(max(res.status, http.StatusOK))
+		fmt.Fprint(w, res.body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// recordWaits は待ち時間を記録して即座に再試行させる
+func recordWaits(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	orig := retryAfter
+	retryAfter = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	t.Cleanup(func() { retryAfter = orig })
+	return &waits
+}
+
+func TestClientRetries(t *testing.T) {
+	const okBody = `{"ok":true,"ts":"1700000000.000100"}`
+	tests := []struct {
+		name       string
+		responses  []stubResponse
+		maxRetries int
+		wantCalls  int
+		wantWaits  []time.Duration
+		wantTS     string
+		wantErr    *RateLimitedError
+	}{
+		{
+			name:      "ratelimited body is retried",
+			responses: []stubResponse{{retryAfter: "2", body: `{"ok":false,"error":"ratelimited"}`}, {body: okBody}},
+			wantCalls: 2,
+			wantWaits: []time.Duration{2 * time.Second},
+			wantTS:    "1700000000.000100",
+		},
+		{
+			name:      "429 honors Retry-After",
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "3"}, {body: okBody}},
+			wantCalls: 2,
+			wantWaits: []time.Duration{3 * time.Second},
+			wantTS:    "1700000000.000100",
+		},
+		{
+			name:      "invalid Retry-After waits one second",
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "soon"}, {body: okBody}},
+			wantCalls: 2,
+			wantWaits: []time.Duration{time.Second},
+			wantTS:    "1700000000.000100",
+		},
+		{
+			name:       "gives up after max retries",
+			responses:  []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "1"}},
+			maxRetries: 2,
+			wantCalls:  3,
+			wantWaits:  []time.Duration{time.Second, time.Second},
+			wantErr:    &RateLimitedError{Method: "chat.postMessage", RetryAfter: time.Second},
+		},
+		{
+			name:      "too long Retry-After is not waited for",
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "120"}},
+			wantCalls: 1,
+			wantErr:   &RateLimitedError{Method: "chat.postMessage", RetryAfter: 120 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := recordWaits(t)
+			srv, calls := newSlackStub(t, tt.responses...)
+			c := NewClient("xoxb-test", ClientOptions{BaseURL: srv.URL, MaxRetries: tt.maxRetries})
+
+			ts, err := c.PostMessage(context.Background(), Message{Channel: "C1", Text: "hi"})
+			if tt.wantErr != nil {
+				var rl *RateLimitedError
+				if !errors.As(err, &rl) || *rl != *tt.wantErr {
+					t.Errorf("PostMessage error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil || ts != tt.wantTS {
+				t.Errorf("PostMessage = (%q, %v), want (%q, nil)", ts, err, tt.wantTS)
+			}
+			if got := int(calls.Load()); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(*waits, tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", *waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	srv, _ := newSlackStub(t, stubResponse{body: `{"ok":false,"error":"channel_not_found"}`})
+	c := NewClient("xoxb-test", ClientOptions{BaseURL: srv.URL})
+
+	_, err := c.PostMessage(context.Background(), Message{Channel: "C1", Text: "hi"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("PostMessage error = %v, want *APIError", err)
+	}
+	if apiErr.Method != "chat.postMessage" || apiErr.Code != "channel_not_found" {
+		t.Errorf("APIError = %+v, want chat.postMessage / channel_not_found", apiErr)
+	}
+	if got := ErrorCode(fmt.Errorf("wrapped: %w", err)); got != "channel_not_found" {
+		t.Errorf("ErrorCode(wrapped) = %q, want channel_not_found", got)
+	}
+	if got := ErrorCode(errors.New("network")); got != "" {
+		t.Errorf("ErrorCode(other) = %q, want empty", got)
+	}
+}
+
+func TestClientCancelDuringBackoff(t *testing.T) {
+	srv, calls := newSlackStub(t, stubResponse{status: http.StatusTooManyRequests, retryAfter: "1"})
+	c := NewClient("xoxb-test", ClientOptions{BaseURL: srv.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	orig := retryAfter
+	retryAfter = func(time.Duration) <-chan time.Time {
+		// 待っている間にキャンセルされる（タイマーは発火しない）
+		cancel()
+		return nil
+	}
+	t.Cleanup(func() { retryAfter = orig })
+
+	if _, err := c.PostMessage(ctx, Message{Channel: "C1", Text: "hi"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("PostMessage error = %v, want context.Canceled", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1 (no retry after cancel)", got)
+	}
+}
+
+func TestDefaultClientUsesEnv(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"ok":true,"channel":{"id":"D1"}}`)
+	}))
+	defer srv.Close()
+	t.Setenv("SLACK_API_BASE_URL", srv.URL)
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-env")
+
+	channel, err := DefaultClient().OpenConversation(context.Background(), "U1")
+	if err != nil || channel != "D1" {
+		t.Fatalf("OpenConversation = (%q, %v), want (D1, nil)", channel, err)
+	}
+	if gotPath != "/conversations.open" || gotAuth != "Bearer xoxb-env" {
+		t.Errorf("request = %s with %q, want /conversations.open with Bearer xoxb-env", gotPath, gotAuth)
+	}
+}
+
+func TestClientWithoutToken(t *testing.T) {
+	srv, calls := newSlackStub(t, stubResponse{body: `{"ok":true}`})
+	c := NewClient("", ClientOptions{BaseURL: srv.URL})
+
+	if _, err := c.PostMessage(context.Background(), Message{Channel: "C1"}); !errors.Is(err, ErrNoToken) {
+		t.Errorf("PostMessage error = %v, want ErrNoToken", err)
+	}
+	if got := calls.Load(); got != 0 {
+		t.Errorf("calls = %d, want 0", got)
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
-	"time"
+
+	"slack-bot/backend/internal/knowledge"
 )
 
 func HandleAskCommand(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +31,7 @@ func HandleAskCommand(w http.ResponseWriter, r *http.Request) {
 	command := r.PostFormValue("command")
 	text := r.PostFormValue("text")
 	responseURL := r.PostFormValue("response_url")
+	userID := r.PostFormValue("user_id")
 
 	if responseURL == "" {
 		log.Printf("Missing response_url")
@@ -38,138 +39,192 @@ func HandleAskCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiBase := os.Getenv("BACKEND_API_URL")
-	if apiBase == "" {
-		apiBase = "http://localhost:8080"
+	// ワークスペースに対応する組織と Bot トークンを解決する
+	ws, err := resolveWorkspace(r.Context(), r.PostFormValue("team_id"))
+	if err != nil {
+		log.Printf("Failed to resolve workspace %s: %v", r.PostFormValue("team_id"), err)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"response_type":"ephemeral","text":"このワークスペースではアプリが有効になっていません。管理者に再インストールを依頼してください。"}`)
+		return
 	}
 
-	// 即座にACK応答を返す（3秒制限対応）
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, `{"response_type":"ephemeral","text":"処理中です…少々お待ちください。"}`)
+	// ナレッジ登録は連携済みのユーザーのみ行え、作成者として記録する
+	authorID := ""
+	if command == "/register-knowledge" {
+		user, msg := requireAppUser(r.Context(), ws, userID)
+		if user == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": msg})
+			return
+		}
+		authorID = user.ID
+	}
+
+	// /kb edit はモーダルを開くため、trigger_id が失効しないうちに同期的に処理する
+	if command == "/kb" {
+		if sub, arg := parseKBCommand(text); sub == "edit" {
+			w.Header().Set("Content-Type", "application/json")
+			if msg := openEditModal(r.Context(), ws, userID, arg, r.PostFormValue("trigger_id"), responseURL); msg != "" {
+				json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": msg})
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	// 本文なしの /register-knowledge は入力フォーム（モーダル）を開く。trigger_id は3秒で失効するため同期的に行う
+	if command == "/register-knowledge" && strings.TrimSpace(text) == "" {
+		state := registerModalState{ResponseURL: responseURL, ChannelID: r.PostFormValue("channel_id")}
+		if err := openRegisterModal(r.Context(), ws.Client, r.PostFormValue("trigger_id"), state, registerDraft{}); err != nil {
+			log.Printf("Failed to open register modal: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"response_type":"ephemeral","text":"入力フォームを開けませんでした。`+"`/register-knowledge タイトル|本文`"+` で登録してください。"}`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 
 	// ログ出力
 	log.Printf("Received command: %s, text: %s", command, text)
 
-	// 重い処理は別ゴルーチンで実行し、response_url に遅延レスポンスを投げる
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Panic in slack command handler: %v", r)
-				sendErrorResponse(responseURL, "内部エラーが発生しました。")
-			}
-		}()
-
+	// 重い処理はワーカープールで実行し、response_url に遅延レスポンスを投げる
+	accepted := runAsync("command "+command, func(ctx context.Context) {
 		switch command {
 		case "/ask":
-			handleAskCommand(apiBase, text, responseURL)
+			handleAskCommand(ctx, ws, text, userID, responseURL)
 		case "/register-knowledge":
-			handleRegisterKnowledge(apiBase, text, responseURL)
+			handleRegisterKnowledge(ctx, ws, text, authorID, responseURL)
+		case "/kb":
+			handleKBCommand(ctx, ws, text, userID, responseURL)
 		default:
 			log.Printf("Unknown command: %s", command)
 			sendErrorResponse(responseURL, "不明なコマンドです。")
 		}
-	}()
+	})
+
+	// 即座にACK応答を返す（3秒制限対応）
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if !accepted {
+		json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": busyMessage})
+		return
+	}
+	fmt.Fprint(w, `{"response_type":"ephemeral","text":"処理中です…少々お待ちください。"}`)
 }
 
-func handleAskCommand(apiBase, text, responseURL string) {
+func handleAskCommand(ctx context.Context, ws *Workspace, text, userID, responseURL string) {
 	if strings.TrimSpace(text) == "" {
 		sendErrorResponse(responseURL, "質問内容を入力してください。")
 		return
 	}
 
-	// Backendの /ask を呼んで回答生成
-	reqBody, err := json.Marshal(map[string]string{"question": text})
+	result, err := ask(ctx, ws.OrgID, text, userID)
 	if err != nil {
-		log.Printf("Failed to marshal request: %v", err)
-		sendErrorResponse(responseURL, "リクエスト作成に失敗しました。")
+		log.Printf("Ask failed: %v", err)
+		sendErrorResponse(responseURL, "回答生成に失敗しました。")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
-	defer cancel()
+	// 回答できなかった質問は専門家に転送する（スレッドがないため回答はDMで届ける）
+	note := escalate(ctx, ws, text, userID, "", "", result)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiBase+"/ask", bytes.NewBuffer(reqBody))
-	if err != nil {
-		log.Printf("Failed to create request: %v", err)
-		sendErrorResponse(responseURL, "リクエスト作成に失敗しました。")
+	answer := formatAnswer(result)
+	if answer == "" {
+		sendErrorResponse(responseURL, joinNote("関連ナレッジが見つかりませんでした。", note))
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("Failed to call backend API: %v", err)
-		sendErrorResponse(responseURL, "回答生成に失敗しました。サーバーに接続できません。")
-		return
+	// まず本人にのみ表示し、「チャンネルに共有」ボタンで共有できるようにする
+	// text は通知用のフォールバック
+	payload := map[string]any{
+		"response_type": "ephemeral",
+		"text":          answer,
+		"blocks":        withNote(buildAnswerBlocks(text, result, true), note),
 	}
-	defer resp.Body.Close()
+	sendResponse(responseURL, payload)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Backend API returned status: %d", resp.StatusCode)
-		sendErrorResponse(responseURL, "回答生成に失敗しました。")
-		return
+// formatAnswer は回答本文を返す（根拠に不審な内容が含まれる場合は注意書きを添える）
+func formatAnswer(result *knowledge.AskResult) string {
+	answer := strings.TrimSpace(result.Answer)
+	if answer == "" {
+		return ""
 	}
-
-	var result map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Printf("Failed to decode response: %v", err)
-		sendErrorResponse(responseURL, "レスポンス解析に失敗しました。")
-		return
+	if result.Suspicious {
+		answer += "\n\n:warning: 質問または参照したナレッジに不審な指示文が含まれている可能性があります。回答内容を鵜呑みにせず確認してください。"
 	}
+	return answer
+}
 
-	answer, ok := result["answer"].(string)
-	if !ok || strings.TrimSpace(answer) == "" {
-		sendErrorResponse(responseURL, "関連ナレッジが見つかりませんでした。")
-		return
-	}
+// forceFlag を先頭に付けると重複候補の確認を済ませたものとして登録する
+const forceFlag = "--force"
 
-	// 成功レスポンス送信（in_channel でチャンネルに共有）
-	payload := map[string]any{
-		"response_type": "in_channel",
-		"text":          answer,
+func handleRegisterKnowledge(ctx context.Context, ws *Workspace, text, authorID, responseURL string) {
+	confirmed := false
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, forceFlag) {
+		confirmed = true
+		text = strings.TrimPrefix(trimmed, forceFlag)
 	}
-	sendResponse(responseURL, payload)
-}
 
-func handleRegisterKnowledge(apiBase, text, responseURL string) {
 	title, content := parseTitleContent(text)
 	if title == "" || content == "" {
-		sendErrorResponse(responseURL, "登録形式: `/register-knowledge タイトル|本文`")
-		return
-	}
-
-	// Backendに登録
-	reqBody, err := json.Marshal(map[string]string{"title": title, "content": content})
-	if err != nil {
-		log.Printf("Failed to marshal knowledge request: %v", err)
-		sendErrorResponse(responseURL, "リクエスト作成に失敗しました。")
+		sendErrorResponse(responseURL, "登録形式: `/register-knowledge タイトル|本文`（引数なしで実行すると入力フォームを開きます）")
 		return
 	}
 
-	resp, err := http.Post(apiBase+"/knowledge", "application/json", bytes.NewBuffer(reqBody))
+	result, err := registerKnowledge(ctx, knowledgeInput{Title: title, Content: content, CreatedBy: authorID, OrgID: ws.OrgID}, confirmed)
 	if err != nil {
 		log.Printf("Failed to register knowledge: %v", err)
-		sendErrorResponse(responseURL, "ナレッジ登録に失敗しました。サーバーに接続できません。")
+		sendErrorResponse(responseURL, "ナレッジ登録に失敗しました。")
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		log.Printf("Knowledge registration failed with status: %d", resp.StatusCode)
-		sendErrorResponse(responseURL, "ナレッジ登録に失敗しました。")
+	if result.Conflict {
+		msg := conflictMessage(result)
+		if result.RequiresConfirmation {
+			msg += fmt.Sprintf("\nそれでも登録する場合は `/register-knowledge %s タイトル|本文` を実行してください。", forceFlag)
+		}
+		sendErrorResponse(responseURL, msg)
 		return
 	}
 
-	// 成功レスポンス
-	msg := fmt.Sprintf("ナレッジを登録しました：%s", title)
 	payload := map[string]any{
 		"response_type": "ephemeral",
-		"text":          msg,
+		"text":          registeredMessage(title, result),
 	}
 	sendResponse(responseURL, payload)
 }
 
+// registeredMessage は登録完了のメッセージ（タイトル案・類似ナレッジがあれば添える）
+func registeredMessage(title string, result *registrationResult) string {
+	msg := fmt.Sprintf("ナレッジを登録しました：%s", title)
+	if result.ID != 0 {
+		msg = fmt.Sprintf("ナレッジを登録しました：<%s|%s>", knowledgeURL(result.ID), escapeMrkdwn(title))
+	}
+	if result.SuggestedTitle != "" {
+		msg += fmt.Sprintf("\nタイトル案：%s（Webから採用できます）", result.SuggestedTitle)
+	}
+	if len(result.Duplicates) > 0 {
+		msg += "\n類似するナレッジがあります。必要に応じて統合してください。\n" + formatDuplicates(result.Duplicates)
+	}
+	return msg
+}
+
+// conflictMessage は類似ナレッジがあり登録しなかったことを伝えるメッセージ
+func conflictMessage(result *registrationResult) string {
+	return "類似するナレッジが既に登録されています。\n" + formatDuplicates(result.Duplicates)
+}
+
+func formatDuplicates(duplicates []knowledge.Duplicate) string {
+	var b strings.Builder
+	for _, d := range duplicates {
+		fmt.Fprintf(&b, "• #%d %s（類似度 %.0f%%）\n", d.ID, d.Title, d.Similarity*100)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
 func sendResponse(responseURL string, payload map[string]any) {
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -0,0 +1,125 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 重複判定の保持期間
+const (
+	// signatureTTL は署名の保持期間。これより古いリクエストはタイムスタンプの検証で拒否される
+	signatureTTL = 5 * time.Minute
+	// eventTTL は event_id の保持期間。Slack の再送（直後・1分後・5分後）を覆う
+	eventTTL = time.Hour
+)
+
+// dedupeStore は一定時間内に同じキーを2回処理しないための記録
+type dedupeStore struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // キー → 期限
+	// nextSweep 以降の claim で期限切れのキーを掃除する
+	nextSweep time.Time
+	// now は現在時刻（テストで置き換える）
+	now func() time.Time
+}
+
+func newDedupeStore() *dedupeStore {
+	return &dedupeStore{entries: map[string]time.Time{}, now: time.Now}
+}
+
+// claim は key を ttl の間記録する。既に記録されていれば false を返す
+func (d *dedupeStore) claim(key string, ttl time.Duration) bool {
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.After(d.nextSweep) {
+		for k, exp := range d.entries {
+			if now.After(exp) {
+				delete(d.entries, k)
+			}
+		}
+		d.nextSweep = now.Add(time.Minute)
+	}
+
+	if exp, ok := d.entries[key]; ok && now.Before(exp) {
+		return false
+	}
+	d.entries[key] = now.Add(ttl)
+	return true
+}
+
+// release は処理できなかったキーの記録を消し、再送で処理できるようにする
+func (d *dedupeStore) release(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, key)
+}
+
+func (d *dedupeStore) size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+// seenRequests は署名・event_id の記録（プロセス内のみ）
+var seenRequests = newDedupeStore()
+
+// requestMetrics は重複・リプレイの件数
+var requestMetrics struct {
+	Received        atomic.Int64
+	RetriesReceived atomic.Int64
+	RetriesAcked    atomic.Int64
+	ReplaysRejected atomic.Int64
+	BusyRejected    atomic.Int64
+}
+
+// Metrics は Slack リクエストの処理状況
+type Metrics struct {
+	// Received は署名検証を通ったリクエスト数
+	Received int64 `json:"received"`
+	// RetriesReceived は X-Slack-Retry-Num 付きの再送の数
+	RetriesReceived int64 `json:"retries_received"`
+	// RetriesAcked は処理済みのため応答だけ返した再送の数
+	RetriesAcked int64 `json:"retries_acked"`
+	// ReplaysRejected は同じ署名のリクエストを拒否した数
+	ReplaysRejected int64 `json:"replays_rejected"`
+	// BusyRejected は混み合っていて受け付けなかった処理の数
+	BusyRejected int64 `json:"busy_rejected"`
+	// DedupeEntries は現在保持している署名・event_id の数
+	DedupeEntries int `json:"dedupe_entries"`
+	// QueueDepth はワーカープールの処理待ちの数
+	QueueDepth int `json:"queue_depth"`
+}
+
+// GetMetrics は現在の処理状況を返す
+func GetMetrics() Metrics {
+	return Metrics{
+		Received:        requestMetrics.Received.Load(),
+		RetriesReceived: requestMetrics.RetriesReceived.Load(),
+		RetriesAcked:    requestMetrics.RetriesAcked.Load(),
+		ReplaysRejected: requestMetrics.ReplaysRejected.Load(),
+		BusyRejected:    requestMetrics.BusyRejected.Load(),
+		DedupeEntries:   seenRequests.size(),
+		QueueDepth:      queueDepth(),
+	}
+}
+
+// HandleMetrics は Slack リクエストの処理状況を返す
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"data":      GetMetrics(),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,212 @@
+package slack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock はテスト用の時計
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestDedupeStore() (*dedupeStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)}
+	d := newDedupeStore()
+	d.now = clock.now
+	return d, clock
+}
+
+func TestDedupeStore(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		release string
+		claim   string
+		ttl     time.Duration
+		want    bool
+	}
+	tests := []struct {
+		name     string
+		steps    []step
+		wantSize int
+	}{
+		{
+			name:     "first claim succeeds",
+			steps:    []step{{claim: "event:E1", ttl: eventTTL, want: true}},
+			wantSize: 1,
+		},
+		{
+			name: "duplicate within ttl is rejected",
+			steps: []step{
+				{claim: "event:E1", ttl: eventTTL, want: true},
+				{advance: 5 * time.Minute, claim: "event:E1", ttl: eventTTL, want: false},
+				{claim: "event:E2", ttl: eventTTL, want: true},
+			},
+			wantSize: 2,
+		},
+		{
+			name: "claim after expiry succeeds",
+			steps: []step{
+				{claim: "sig:v0=abc", ttl: signatureTTL, want: true},
+				{advance: signatureTTL + time.Second, claim: "sig:v0=abc", ttl: signatureTTL, want: true},
+			},
+			wantSize: 1,
+		},
+		{
+			name: "released key can be claimed again",
+			steps: []step{
+				{claim: "event:E1", ttl: eventTTL, want: true},
+				{release: "event:E1", claim: "event:E1", ttl: eventTTL, want: true},
+				{claim: "event:E1", ttl: eventTTL, want: false},
+			},
+			wantSize: 1,
+		},
+		{
+			name: "expired keys are swept",
+			steps: []step{
+				{claim: "sig:v0=a", ttl: signatureTTL, want: true},
+				{claim: "sig:v0=b", ttl: signatureTTL, want: true},
+				{claim: "event:E1", ttl: eventTTL, want: true},
+				{advance: 10 * time.Minute, claim: "event:E2", ttl: eventTTL, want: true},
+			},
+			wantSize: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, clock := newTestDedupeStore()
+			for i, s := range tt.steps {
+				clock.advance(s.advance)
+				if s.release != "" {
+					d.release(s.release)
+				}
+				if got := d.claim(s.claim, s.ttl); got != s.want {
+					t.Errorf("step %d: claim(%q) = %v, want %v", i, s.claim, got, s.want)
+				}
+			}
+			if got := d.size(); got != tt.wantSize {
+				t.Errorf("size() = %d, want %d", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signedRequest は testSigningSecret で署名した Slack からのリクエストを作る
+func signedRequest(target, body string, ts time.Time) *http.Request {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", slackSignature(testSigningSecret, timestamp, body))
+	return r
+}
+
+// useDedupeStore はテストの間 seenRequests を新しい記録に差し替える
+func useDedupeStore(t *testing.T) *dedupeStore {
+	t.Helper()
+	orig := seenRequests
+	seenRequests = newDedupeStore()
+	t.Cleanup(func() { seenRequests = orig })
+	return seenRequests
+}
+
+// useWorkerPool はテストの間ワーカープールを差し替える。ワーカーを起動しないため処理は実行されない
+func useWorkerPool(t *testing.T, queueSize int) *workerPool {
+	t.Helper()
+	p := &workerPool{jobs: make(chan poolJob, queueSize)}
+	workers.mu.Lock()
+	orig := workers.pool
+	workers.pool = p
+	workers.mu.Unlock()
+	t.Cleanup(func() {
+		workers.mu.Lock()
+		workers.pool = orig
+		workers.mu.Unlock()
+	})
+	return p
+}
+
+func TestHandleEventsReleasesEventWhenBusy(t *testing.T) {
+	t.Setenv("SLACK_SIGNING_SECRET", testSigningSecret)
+	t.Setenv("SLACK_SIGNING_SECRETS", "")
+	seen := useDedupeStore(t)
+	before := GetMetrics()
+
+	const body = `{"type":"event_callback","team_id":"T1","event_id":"Ev1","event":{"type":"app_mention","user":"U1","text":"hi"}}`
+	now := time.Now()
+	deliver := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		HandleEvents(w, r)
+		return w.Code
+	}
+
+	// 混み合っていれば 503 を返し、再送で処理できるよう event_id の記録を消す
+	useWorkerPool(t, 0)
+	if got := deliver(signedRequest("/slack/events", body, now.Add(-3*time.Second))); got != http.StatusServiceUnavailable {
+		t.Fatalf("busy delivery = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+	if seen.claim("event:Ev1", eventTTL) {
+		seen.release("event:Ev1")
+	} else {
+		t.Errorf("event:Ev1 is still claimed after a busy rejection")
+	}
+
+	// 再送は受け付けられる
+	pool := useWorkerPool(t, 1)
+	retry := signedRequest("/slack/events", body, now.Add(-2*time.Second))
+	retry.Header.Set("X-Slack-Retry-Num", "1")
+	if got := deliver(retry); got != http.StatusOK {
+		t.Fatalf("retry = %d, want %d", got, http.StatusOK)
+	}
+	if got := len(pool.jobs); got != 1 {
+		t.Errorf("queued jobs = %d, want 1", got)
+	}
+
+	// 処理済みの event_id の再送は応答だけ返す
+	second := signedRequest("/slack/events", body, now.Add(-time.Second))
+	second.Header.Set("X-Slack-Retry-Num", "2")
+	if got := deliver(second); got != http.StatusOK {
+		t.Fatalf("second retry = %d, want %d", got, http.StatusOK)
+	}
+	if got := len(pool.jobs); got != 1 {
+		t.Errorf("queued jobs after duplicate = %d, want 1", got)
+	}
+
+	// 同じ署名のリクエストはリプレイとして拒否する
+	replay := signedRequest("/slack/events", body, now.Add(-time.Second))
+	replay.Header.Set("X-Slack-Retry-Num", "2")
+	if got := deliver(replay); got != http.StatusUnauthorized {
+		t.Fatalf("replay = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	after := GetMetrics()
+	counters := []struct {
+		name          string
+		before, after int64
+		want          int64
+	}{
+		{"Received", before.Received, after.Received, 4},
+		{"RetriesReceived", before.RetriesReceived, after.RetriesReceived, 3},
+		{"RetriesAcked", before.RetriesAcked, after.RetriesAcked, 1},
+		{"ReplaysRejected", before.ReplaysRejected, after.ReplaysRejected, 1},
+		{"BusyRejected", before.BusyRejected, after.BusyRejected, 1},
+	}
+	for _, c := range counters {
+		if got := c.after - c.before; got != c.want {
+			t.Errorf("%s increased by %d, want %d", c.name, got, c.want)
+		}
+	}
+	if after.QueueDepth != 1 {
+		t.Errorf("QueueDepth = %d, want 1", after.QueueDepth)
+	}
+	// 署名3件 + event_id 1件
+	if after.DedupeEntries != 4 {
+		t.Errorf("DedupeEntries = %d, want 4", after.DedupeEntries)
+	}
+}
@@ -0,0 +1,380 @@
+package slack
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"slack-bot/backend/internal/auth"
+	"slack-bot/backend/internal/knowledge"
+)
+
+// ダイジェストの頻度
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// ダイジェストに載せる件数
+const (
+	digestKnowledgeLimit = 10
+	digestQuestionLimit  = 5
+)
+
+// DigestSetting はチャンネルへ定期投稿するダイジェストの設定
+type DigestSetting struct {
+	ID        int64  `json:"id"`
+	OrgID     int64  `json:"org_id"`
+	ChannelID string `json:"channel_id"`
+	// Frequency は DigestDaily または DigestWeekly
+	Frequency string `json:"frequency"`
+	// Weekday は weekly の場合の曜日（0 = 日曜）
+	Weekday int `json:"weekday"`
+	// Hour は投稿する時刻（Timezone の現地時刻）
+	Hour       int        `json:"hour"`
+	Timezone   string     `json:"timezone"`
+	Enabled    bool       `json:"enabled"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// period はダイジェストの対象期間
+func (s DigestSetting) period() time.Duration {
+	if s.Frequency == DigestDaily {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// lastScheduled は now 以前で直近の投稿予定時刻を返す
+func (s DigestSetting) lastScheduled(now time.Time, loc *time.Location) time.Time {
+	year, month, day := now.In(loc).Date()
+	back, step := 0, 1
+	if s.Frequency == DigestWeekly {
+		back = (int(now.In(loc).Weekday()) - s.Weekday + 7) % 7
+		step = 7
+	}
+	t := s.at(year, month, day-back, loc)
+	if t.After(now) {
+		t = s.at(year, month, day-back-step, loc)
+	}
+	return t
+}
+
+// at はその日の投稿予定時刻。夏時間の開始で存在しない時刻は切り替え直後にする
+func (s DigestSetting) at(year int, month time.Month, day int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, s.Hour, 0, 0, 0, loc)
+	if t.Hour() != s.Hour {
+		// time.Date は切り替え前のオフセットで解釈するため、オフセットの差だけ進める
+		_, before := t.Zone()
+		_, after := t.Add(time.Hour).Zone()
+		t = t.Add(time.Duration(after-before) * time.Second)
+	}
+	return t
+}
+
+// validate は設定値を検証し、タイムゾーンを返す
+func (s DigestSetting) validate() (*time.Location, error) {
+	if s.ChannelID == "" {
+		return nil, errors.New("channel_id is required")
+	}
+	if s.Frequency != DigestDaily && s.Frequency != DigestWeekly {
+		return nil, fmt.Errorf("frequency must be %q or %q", DigestDaily, DigestWeekly)
+	}
+	if s.Weekday < 0 || s.Weekday > 6 {
+		return nil, errors.New("weekday must be between 0 and 6")
+	}
+	if s.Hour < 0 || s.Hour > 23 {
+		return nil, errors.New("hour must be between 0 and 23")
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// digestStore は digest_settings テーブルを扱う
+type digestStore struct {
+	db *sql.DB
+}
+
+const digestColumns = `id, org_id, channel_id, frequency, weekday, hour, timezone, enabled, last_sent_at, created_at`
+
+func (s *digestStore) query(ctx context.Context, where string, args ...any) ([]DigestSetting, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+digestColumns+" FROM digest_settings WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DigestSetting
+	for rows.Next() {
+		var d DigestSetting
+		var lastSent sql.NullTime
+		if err := rows.Scan(&d.ID, &d.OrgID, &d.ChannelID, &d.Frequency, &d.Weekday, &d.Hour,
+			&d.Timezone, &d.Enabled, &lastSent, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lastSent.Valid {
+			d.LastSentAt = &lastSent.Time
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// ListEnabled は有効な設定を全組織分返す
+func (s *digestStore) ListEnabled(ctx context.Context) ([]DigestSetting, error) {
+	return s.query(ctx, "enabled")
+}
+
+// ListByOrg は組織の設定を返す
+func (s *digestStore) ListByOrg(ctx context.Context, orgID int64) ([]DigestSetting, error) {
+	return s.query(ctx, "org_id = $1", orgID)
+}
+
+// Save は組織・チャンネルごとの設定を作成または更新する
+func (s *digestStore) Save(ctx context.Context, d *DigestSetting) error {
+	return s.db.QueryRowContext(ctx, `
+	INSERT INTO digest_settings (org_id, channel_id, frequency, weekday, hour, timezone, enabled)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (org_id, channel_id) DO UPDATE SET
+		frequency = EXCLUDED.frequency,
+		weekday = EXCLUDED.weekday,
+		hour = EXCLUDED.hour,
+		timezone = EXCLUDED.timezone,
+		enabled = EXCLUDED.enabled
+	RETURNING id, created_at`,
+		d.OrgID, d.ChannelID, d.Frequency, d.Weekday, d.Hour, d.Timezone, d.Enabled).Scan(&d.ID, &d.CreatedAt)
+}
+
+// Claim は予定時刻の分をまだ投稿していなければ投稿済みにして true を返す（複数台で動かしても二重投稿しない）
+func (s *digestStore) Claim(ctx context.Context, id int64, scheduled time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+	UPDATE digest_settings SET last_sent_at = NOW()
+	WHERE id = $1 AND enabled AND (last_sent_at IS NULL OR last_sent_at < $2)`, id, scheduled)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Release は投稿に失敗した設定を Claim 前の状態に戻し、次の確認で再び投稿できるようにする
+func (s *digestStore) Release(ctx context.Context, id int64, lastSentAt *time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE digest_settings SET last_sent_at = $2 WHERE id = $1", id, lastSentAt)
+	return err
+}
+
+// digests は RegisterSlackHandlers で DB が渡された場合に設定される
+var digests *digestStore
+
+// RunDigestScheduler は interval ごとに投稿予定時刻を過ぎたダイジェストを投稿する（ctx が終わるまで続ける）
+func RunDigestScheduler(ctx context.Context, interval time.Duration) {
+	if digests == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sendDueDigests(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sendDueDigests(ctx context.Context, now time.Time) {
+	settings, err := digests.ListEnabled(ctx)
+	if err != nil {
+		log.Printf("Failed to list digest settings: %v", err)
+		return
+	}
+
+	for _, d := range settings {
+		loc, err := d.validate()
+		if err != nil {
+			log.Printf("Invalid digest setting %d: %v", d.ID, err)
+			continue
+		}
+
+		scheduled := d.lastScheduled(now, loc)
+		// 設定前の予定時刻の分は投稿しない
+		last := d.CreatedAt
+		if d.LastSentAt != nil {
+			last = *d.LastSentAt
+		}
+		if !last.Before(scheduled) {
+			continue
+		}
+
+		// 複数台での二重投稿を防ぐため投稿前に確保し、投稿に失敗したら確保を戻す
+		claimed, err := digests.Claim(ctx, d.ID, scheduled)
+		if err != nil {
+			log.Printf("Failed to claim digest %d: %v", d.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := sendDigest(ctx, d, scheduled.Add(-d.period()), loc); err != nil {
+			log.Printf("Failed to send digest %d to %s: %v", d.ID, d.ChannelID, err)
+			if err := digests.Release(ctx, d.ID, d.LastSentAt); err != nil {
+				log.Printf("Failed to release digest %d: %v", d.ID, err)
+			}
+		}
+	}
+}
+
+// sendDigest は since 以降に登録・更新されたナレッジと、よく聞かれている未回答の質問を投稿する
+func sendDigest(ctx context.Context, d DigestSetting, since time.Time, loc *time.Location) error {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return errNoKnowledgeService
+	}
+
+	changed, err := svc.ListChangedSince(since, digestKnowledgeLimit*2)
+	if err != nil {
+		return fmt.Errorf("failed to list knowledge: %w", err)
+	}
+	createdCount, updatedCount, err := svc.CountChangedSince(since)
+	if err != nil {
+		return fmt.Errorf("failed to count knowledge: %w", err)
+	}
+	gaps, err := svc.GapReport(d.OrgID, since)
+	if err != nil {
+		return fmt.Errorf("failed to build gap report: %w", err)
+	}
+
+	var created, updated []knowledge.Knowledge
+	for _, k := range changed {
+		if !k.CreatedAt.Before(since) {
+			created = append(created, k)
+		} else {
+			updated = append(updated, k)
+		}
+	}
+	if createdCount == 0 && updatedCount == 0 && len(gaps) == 0 {
+		log.Printf("Digest %d has nothing to report", d.ID)
+		return nil
+	}
+
+	ws, err := workspaceForOrg(ctx, d.OrgID)
+	if err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("ナレッジダイジェスト（%s〜）", since.In(loc).Format("1/2"))
+	_, err = ws.Client.PostMessage(ctx, Message{
+		Channel: d.ChannelID,
+		Text:    title,
+		Blocks:  buildDigestBlocks(title, created, createdCount, updated, updatedCount, gaps),
+	})
+	return err
+}
+
+// buildDigestBlocks は created・updated の先頭を一覧にし、件数は createdCount・updatedCount を表示する
+func buildDigestBlocks(title string, created []knowledge.Knowledge, createdCount int, updated []knowledge.Knowledge, updatedCount int, gaps []knowledge.GapCluster) []map[string]any {
+	blocks := []map[string]any{
+		{"type": "header", "text": plainText(title)},
+	}
+	section := func(text string) {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": text},
+		})
+	}
+
+	if createdCount > 0 {
+		section(digestList(fmt.Sprintf("*新しく登録されたナレッジ（%d件）*", createdCount), created, createdCount))
+	}
+	if updatedCount > 0 {
+		section(digestList(fmt.Sprintf("*更新されたナレッジ（%d件）*", updatedCount), updated, updatedCount))
+	}
+	if len(gaps) > 0 {
+		var b strings.Builder
+		b.WriteString("*よく聞かれている未回答の質問*\n")
+		for i, g := range gaps {
+			if i == digestQuestionLimit {
+				break
+			}
+			fmt.Fprintf(&b, "• %s（%d人・%d回）\n", escapeMrkdwn(truncateRunes(g.Question, 100)), g.People, g.Count)
+		}
+		b.WriteString("回答できる方は `/register-knowledge` で登録してください。")
+		section(b.String())
+	}
+	return blocks
+}
+
+// digestList は items の先頭 digestKnowledgeLimit 件を並べ、total との差を「ほか」の件数にする
+func digestList(heading string, items []knowledge.Knowledge, total int) string {
+	var b strings.Builder
+	b.WriteString(heading + "\n")
+	shown := 0
+	for _, k := range items {
+		if shown == digestKnowledgeLimit {
+			break
+		}
+		fmt.Fprintf(&b, "• %s\n", knowledgeLink(k))
+		shown++
+	}
+	if rest := total - shown; rest > 0 {
+		fmt.Fprintf(&b, "…ほか%d件\n", rest)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// HandleDigestSettings はログイン中のオーナーの組織のダイジェスト設定を取得（GET）・保存（POST）する
+func HandleDigestSettings(w http.ResponseWriter, r *http.Request) {
+	if digests == nil {
+		http.Error(w, "Digests are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := digests.ListByOrg(r.Context(), auth.CurrentOrgID(r))
+		if err != nil {
+			log.Printf("Failed to list digest settings: %v", err)
+			http.Error(w, "Failed to fetch", http.StatusInternalServerError)
+			return
+		}
+		if settings == nil {
+			settings = []DigestSetting{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+
+	case http.MethodPost:
+		d := DigestSetting{Frequency: DigestWeekly, Weekday: 1, Hour: 9, Timezone: "Asia/Tokyo", Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+		d.OrgID = auth.CurrentOrgID(r)
+		if _, err := d.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := digests.Save(r.Context(), &d); err != nil {
+			log.Printf("Failed to save digest setting: %v", err)
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,125 @@
+package slack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestSettingLastScheduled(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setting DigestSetting
+		loc     *time.Location
+		now     time.Time
+		want    time.Time
+	}{
+		{
+			name:    "daily after the hour is today",
+			setting: DigestSetting{Frequency: DigestDaily, Hour: 9},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 19, 10, 0, 0, 0, tokyo),
+			want:    time.Date(2026, 10, 19, 9, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "daily exactly at the hour is today",
+			setting: DigestSetting{Frequency: DigestDaily, Hour: 9},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 19, 9, 0, 0, 0, tokyo),
+			want:    time.Date(2026, 10, 19, 9, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "daily before the hour is yesterday",
+			setting: DigestSetting{Frequency: DigestDaily, Hour: 9},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 19, 8, 59, 0, 0, tokyo),
+			want:    time.Date(2026, 10, 18, 9, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "daily uses the local date, not UTC",
+			setting: DigestSetting{Frequency: DigestDaily, Hour: 8},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC), // 10/19 08:30 JST
+			want:    time.Date(2026, 10, 19, 8, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "weekly on the weekday after the hour is today",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Monday), Hour: 9},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 19, 12, 0, 0, 0, tokyo), // Monday
+			want:    time.Date(2026, 10, 19, 9, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "weekly on the weekday before the hour is last week",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Monday), Hour: 9},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 19, 8, 0, 0, 0, tokyo),
+			want:    time.Date(2026, 10, 12, 9, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "weekly sunday seen from saturday",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Sunday), Hour: 9},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 24, 23, 0, 0, 0, tokyo), // Saturday
+			want:    time.Date(2026, 10, 18, 9, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "weekly saturday seen from sunday",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Saturday), Hour: 18},
+			loc:     tokyo,
+			now:     time.Date(2026, 10, 25, 1, 0, 0, 0, tokyo), // Sunday
+			want:    time.Date(2026, 10, 24, 18, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "daily across the spring-forward change keeps the local hour",
+			setting: DigestSetting{Frequency: DigestDaily, Hour: 9},
+			loc:     newYork,
+			now:     time.Date(2026, 3, 8, 8, 0, 0, 0, newYork), // EDT
+			want:    time.Date(2026, 3, 7, 9, 0, 0, 0, newYork), // EST
+		},
+		{
+			name:    "weekly across the spring-forward change keeps the local hour",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Monday), Hour: 9},
+			loc:     newYork,
+			now:     time.Date(2026, 3, 9, 8, 0, 0, 0, newYork), // EDT
+			want:    time.Date(2026, 3, 2, 9, 0, 0, 0, newYork), // EST
+		},
+		{
+			name:    "weekly across the fall-back change keeps the local hour",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Friday), Hour: 9},
+			loc:     newYork,
+			now:     time.Date(2026, 11, 3, 12, 0, 0, 0, newYork), // EST
+			want:    time.Date(2026, 10, 30, 9, 0, 0, 0, newYork), // EDT
+		},
+		{
+			name:    "hour skipped by spring-forward falls on the shifted time",
+			setting: DigestSetting{Frequency: DigestDaily, Hour: 2},
+			loc:     newYork,
+			now:     time.Date(2026, 3, 8, 12, 0, 0, 0, newYork),
+			want:    time.Date(2026, 3, 8, 3, 0, 0, 0, newYork), // 02:00 does not exist
+		},
+		{
+			name:    "weekly hour skipped by spring-forward a week earlier",
+			setting: DigestSetting{Frequency: DigestWeekly, Weekday: int(time.Sunday), Hour: 2},
+			loc:     newYork,
+			now:     time.Date(2026, 3, 15, 1, 0, 0, 0, newYork),
+			want:    time.Date(2026, 3, 8, 3, 0, 0, 0, newYork),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.setting.lastScheduled(tt.now, tt.loc)
+			if !got.Equal(tt.want) {
+				t.Errorf("lastScheduled(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,598 @@
+package slack
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"slack-bot/backend/internal/auth"
+	"slack-bot/backend/internal/knowledge"
+)
+
+// 専門家への転送のボタン・モーダル
+const (
+	actionEscalationAnswer   = "escalation_answer"
+	actionEscalationSave     = "escalation_save"
+	callbackEscalationAnswer = "escalation_answer"
+
+	blockAnswer = "answer"
+)
+
+// anyTag はどのタグにも該当しない質問を担当する専門家のタグ
+const anyTag = "*"
+
+// エスカレーションの状態
+const (
+	escalationOpen     = "open"
+	escalationAnswered = "answered"
+)
+
+// Expert はタグごとの専門家
+type Expert struct {
+	ID          int64     `json:"id"`
+	OrgID       int64     `json:"org_id"`
+	Tag         string    `json:"tag"`
+	SlackUserID string    `json:"slack_user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Escalation は専門家に転送した質問
+type Escalation struct {
+	ID              int64
+	OrgID           int64
+	TeamID          string
+	Tag             string
+	Question        string
+	AskerSlackID    string
+	ChannelID       string
+	ThreadTS        string
+	ExpertSlackID   string
+	ExpertChannelID string
+	ExpertMessageTS string
+	Status          string
+	Answer          string
+	AnsweredBy      string
+	CreatedAt       time.Time
+}
+
+// escalationStore は tag_experts / escalations テーブルを扱う
+type escalationStore struct {
+	db *sql.DB
+}
+
+// ListExperts は組織の専門家を返す
+func (s *escalationStore) ListExperts(ctx context.Context, orgID int64) ([]Expert, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, org_id, tag, slack_user_id, created_at
+	FROM tag_experts
+	WHERE org_id = $1
+	ORDER BY tag, id`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Expert
+	for rows.Next() {
+		var e Expert
+		if err := rows.Scan(&e.ID, &e.OrgID, &e.Tag, &e.SlackUserID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// SaveExpert は専門家を登録する（登録済みであれば何もしない）
+func (s *escalationStore) SaveExpert(ctx context.Context, e *Expert) error {
+	return s.db.QueryRowContext(ctx, `
+	INSERT INTO tag_experts (org_id, tag, slack_user_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (org_id, tag, slack_user_id) DO UPDATE SET tag = EXCLUDED.tag
+	RETURNING id, created_at`, e.OrgID, e.Tag, e.SlackUserID).Scan(&e.ID, &e.CreatedAt)
+}
+
+// DeleteExpert は専門家の登録を取り消す
+func (s *escalationStore) DeleteExpert(ctx context.Context, orgID, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM tag_experts WHERE org_id = $1 AND id = $2`, orgID, id)
+	return err
+}
+
+// OpenCounts は専門家ごとの未回答の件数を返す
+func (s *escalationStore) OpenCounts(ctx context.Context, orgID int64) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT expert_slack_id, COUNT(*)
+	FROM escalations
+	WHERE org_id = $1 AND status = $2
+	GROUP BY expert_slack_id`, orgID, escalationOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// Create は転送した質問を記録する
+func (s *escalationStore) Create(ctx context.Context, e *Escalation) error {
+	return s.db.QueryRowContext(ctx, `
+	INSERT INTO escalations (org_id, team_id, tag, question, asker_slack_id, channel_id, thread_ts, expert_slack_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, status, created_at`,
+		e.OrgID, e.TeamID, e.Tag, e.Question, e.AskerSlackID, e.ChannelID, e.ThreadTS, e.ExpertSlackID).
+		Scan(&e.ID, &e.Status, &e.CreatedAt)
+}
+
+// Delete は専門家に届けられなかった転送を取り消す
+func (s *escalationStore) Delete(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM escalations WHERE id = $1`, id)
+	return err
+}
+
+// Get は転送した質問を返す（なければ nil）
+func (s *escalationStore) Get(ctx context.Context, id int64) (*Escalation, error) {
+	var e Escalation
+	err := s.db.QueryRowContext(ctx, `
+	SELECT id, org_id, team_id, tag, question, asker_slack_id, channel_id, thread_ts, expert_slack_id,
+		expert_channel_id, expert_message_ts, status, answer, answered_by, created_at
+	FROM escalations
+	WHERE id = $1`, id).Scan(&e.ID, &e.OrgID, &e.TeamID, &e.Tag, &e.Question, &e.AskerSlackID, &e.ChannelID,
+		&e.ThreadTS, &e.ExpertSlackID, &e.ExpertChannelID, &e.ExpertMessageTS, &e.Status, &e.Answer, &e.AnsweredBy, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// SetExpertMessage は専門家に送ったDMを記録する
+func (s *escalationStore) SetExpertMessage(ctx context.Context, id int64, channel, ts string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE escalations SET expert_channel_id = $2, expert_message_ts = $3 WHERE id = $1`, id, channel, ts)
+	return err
+}
+
+// Answer は転送先の専門家の回答を記録する。既に回答済み、または転送先でなければ false を返す
+func (s *escalationStore) Answer(ctx context.Context, id int64, answeredBy, answer string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+	UPDATE escalations
+	SET status = $2, answer = $3, answered_by = $4, answered_at = NOW()
+	WHERE id = $1 AND status = $5 AND expert_slack_id = $4`, id, escalationAnswered, answer, answeredBy, escalationOpen)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// escalations は RegisterSlackHandlers で DB が渡された場合に設定される
+var escalations *escalationStore
+
+func init() {
+	RegisterAction(actionEscalationAnswer, handleEscalationAnswer)
+	RegisterAction(actionEscalationSave, handleEscalationSave)
+	RegisterView(callbackEscalationAnswer, handleEscalationSubmission)
+}
+
+// escalate は回答できなかった質問を専門家にDMで転送し、質問者に添えるメッセージを返す。
+// channel・threadTS が空の場合、専門家の回答は質問者へのDMで届ける。担当の専門家がいなければ空を返す
+func escalate(ctx context.Context, ws *Workspace, question, askerID, channel, threadTS string, result *knowledge.AskResult) string {
+	if escalations == nil || result == nil || !result.Unanswered {
+		return ""
+	}
+
+	expert, tag, err := pickExpert(ctx, ws.OrgID, question, askerID, result.Related)
+	if err != nil {
+		log.Printf("Failed to find expert: %v", err)
+		return ""
+	}
+	if expert == "" {
+		return ""
+	}
+
+	e := &Escalation{
+		OrgID:         ws.OrgID,
+		TeamID:        ws.TeamID,
+		Tag:           tag,
+		Question:      question,
+		AskerSlackID:  askerID,
+		ChannelID:     channel,
+		ThreadTS:      threadTS,
+		ExpertSlackID: expert,
+	}
+	if err := escalations.Create(ctx, e); err != nil {
+		log.Printf("Failed to record escalation: %v", err)
+		return ""
+	}
+
+	dm, ts, err := notifyExpert(ctx, ws, e)
+	if err != nil {
+		log.Printf("Failed to notify expert %s: %v", expert, err)
+		// 届かなかった転送は未回答の件数に数えないよう取り消す
+		if err := escalations.Delete(ctx, e.ID); err != nil {
+			log.Printf("Failed to delete escalation %d: %v", e.ID, err)
+		}
+		return ""
+	}
+	if err := escalations.SetExpertMessage(ctx, e.ID, dm, ts); err != nil {
+		log.Printf("Failed to record expert message for escalation %d: %v", e.ID, err)
+	}
+
+	where := "DM"
+	if threadTS != "" {
+		where = "このスレッド"
+	}
+	return fmt.Sprintf(":bust_in_silhouette: 専門家の <@%s> さんに質問を転送しました。回答が届いたら%sでお知らせします。", expert, where)
+}
+
+// notifyExpert は専門家に質問をDMし、DMのチャンネルとメッセージの ts を返す
+func notifyExpert(ctx context.Context, ws *Workspace, e *Escalation) (string, string, error) {
+	dm, err := ws.Client.OpenConversation(ctx, e.ExpertSlackID)
+	if err != nil {
+		return "", "", err
+	}
+	ts, err := ws.Client.PostMessage(ctx, Message{
+		Channel: dm,
+		Text:    fmt.Sprintf("<@%s> さんの質問に回答できるナレッジがありませんでした: %s", e.AskerSlackID, escapeMrkdwn(e.Question)),
+		Blocks:  escalationBlocks(e, true),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return dm, ts, nil
+}
+
+// withNote は回答の Block Kit に転送の案内を添える
+func withNote(blocks []map[string]any, note string) []map[string]any {
+	if note == "" {
+		return blocks
+	}
+	return append(blocks, contextBlock(note))
+}
+
+// joinNote はメッセージに転送の案内を添える
+func joinNote(msg, note string) string {
+	if note == "" {
+		return msg
+	}
+	return msg + "\n" + note
+}
+
+// pickExpert は根拠ナレッジのタグ、質問に含まれるタグ、どのタグにも該当しない質問の担当（*）の順に専門家を探し、
+// 同じタグに複数いる場合は未回答の件数が少ない専門家を選ぶ。質問者本人は除く
+func pickExpert(ctx context.Context, orgID int64, question, askerID string, related []knowledge.Knowledge) (string, string, error) {
+	experts, err := escalations.ListExperts(ctx, orgID)
+	if err != nil {
+		return "", "", err
+	}
+	byTag := map[string][]string{}
+	for _, e := range experts {
+		if e.SlackUserID == askerID {
+			continue
+		}
+		key := strings.ToLower(e.Tag)
+		byTag[key] = append(byTag[key], e.SlackUserID)
+	}
+	if len(byTag) == 0 {
+		return "", "", nil
+	}
+
+	var tags []string
+	for _, k := range related {
+		tags = append(tags, k.Tags...)
+	}
+	for tag := range byTag {
+		if tag != anyTag && knowledge.ContainsTerm(question, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	tags = append(tags, anyTag)
+
+	for _, tag := range tags {
+		candidates := byTag[strings.ToLower(tag)]
+		if len(candidates) == 0 {
+			continue
+		}
+		if len(candidates) == 1 {
+			return candidates[0], tag, nil
+		}
+		counts, err := escalations.OpenCounts(ctx, orgID)
+		if err != nil {
+			return "", "", err
+		}
+		best := candidates[0]
+		for _, c := range candidates[1:] {
+			if counts[c] < counts[best] {
+				best = c
+			}
+		}
+		return best, tag, nil
+	}
+	return "", "", nil
+}
+
+// escalationBlocks は専門家へのDM。回答前は「回答する」、回答後は「ナレッジとして保存」ボタンを付ける
+func escalationBlocks(e *Escalation, open bool) []map[string]any {
+	text := fmt.Sprintf("*<@%s> さんの質問に回答できるナレッジがありませんでした。*\n%s", e.AskerSlackID, quoteMrkdwn(e.Question))
+	if !open {
+		text += fmt.Sprintf("\n\n*<@%s> さんの回答*\n%s", e.AnsweredBy, quoteMrkdwn(e.Answer))
+	}
+	blocks := []map[string]any{
+		{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": text},
+		},
+	}
+	if e.Tag != "" && e.Tag != anyTag {
+		blocks = append(blocks, contextBlock("タグ: "+escapeMrkdwn(e.Tag)))
+	}
+
+	id := strconv.FormatInt(e.ID, 10)
+	if open {
+		blocks = append(blocks, map[string]any{
+			"type":     "actions",
+			"elements": []map[string]any{button(actionEscalationAnswer, "回答する", id, "primary")},
+		})
+		return blocks
+	}
+	blocks = append(blocks,
+		contextBlock(":white_check_mark: 回答を質問者に届けました。今後同じ質問に答えられるよう、ナレッジとして保存できます。"),
+		map[string]any{
+			"type":     "actions",
+			"elements": []map[string]any{button(actionEscalationSave, "ナレッジとして保存", id, "")},
+		},
+	)
+	return blocks
+}
+
+// quoteMrkdwn は複数行のテキストを引用にする
+func quoteMrkdwn(s string) string {
+	lines := strings.Split(escapeMrkdwn(strings.TrimSpace(s)), "\n")
+	return "> " + strings.Join(lines, "\n> ")
+}
+
+// loadEscalation はボタンの value の転送を読み込む
+func loadEscalation(ctx context.Context, value string) (*Escalation, error) {
+	if escalations == nil {
+		return nil, errors.New("escalations are not configured")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	e, err := escalations.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, fmt.Errorf("escalation %d not found", id)
+	}
+	return e, nil
+}
+
+// isEscalationExpert は操作したのが転送先のワークスペースの専門家本人かどうか
+func isEscalationExpert(p *InteractionPayload, e *Escalation) bool {
+	return p.Workspace != nil && p.Workspace.TeamID == e.TeamID && p.User.ID == e.ExpertSlackID
+}
+
+// handleEscalationAnswer は回答を入力するモーダルを開く（転送先の専門家のみ）
+func handleEscalationAnswer(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	e, err := loadEscalation(ctx, action.Value)
+	if err != nil {
+		log.Printf("Failed to load escalation: %v", err)
+		return
+	}
+	if !isEscalationExpert(p, e) {
+		log.Printf("Rejected escalation %d answer by %s (expert %s)", e.ID, p.User.ID, e.ExpertSlackID)
+		if p.ResponseURL != "" {
+			sendErrorResponse(p.ResponseURL, "この質問に回答できるのは転送先の専門家のみです。")
+		}
+		return
+	}
+	if e.Status != escalationOpen {
+		if p.ResponseURL != "" {
+			sendErrorResponse(p.ResponseURL, "この質問には既に回答済みです。")
+		}
+		return
+	}
+
+	view := map[string]any{
+		"type":             "modal",
+		"callback_id":      callbackEscalationAnswer,
+		"private_metadata": strconv.FormatInt(e.ID, 10),
+		"title":            plainText("質問に回答"),
+		"submit":           plainText("回答を送る"),
+		"close":            plainText("キャンセル"),
+		"blocks": []map[string]any{
+			{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": quoteMrkdwn(e.Question)},
+			},
+			inputBlock(blockAnswer, "回答", map[string]any{
+				"type":       "plain_text_input",
+				"action_id":  inputAction,
+				"multiline":  true,
+				"max_length": maxContentRunes,
+			}, false),
+		},
+	}
+	if _, err := p.Workspace.Client.OpenView(ctx, p.TriggerID, view); err != nil {
+		log.Printf("Failed to open escalation answer modal: %v", err)
+	}
+}
+
+// handleEscalationSubmission は回答を検証し、モーダルを閉じて非同期に質問者へ届ける
+func handleEscalationSubmission(ctx context.Context, p *InteractionPayload) (*ViewResponse, error) {
+	answer := strings.TrimSpace(p.View.Input(blockAnswer, inputAction))
+	switch {
+	case answer == "":
+		return ViewErrors(map[string]string{blockAnswer: "回答を入力してください。"}), nil
+	case len([]rune(answer)) > maxContentRunes:
+		return ViewErrors(map[string]string{blockAnswer: fmt.Sprintf("回答は%d文字以内で入力してください。", maxContentRunes)}), nil
+	}
+
+	e, err := loadEscalation(ctx, p.View.PrivateMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if !isEscalationExpert(p, e) {
+		log.Printf("Rejected escalation %d answer by %s (expert %s)", e.ID, p.User.ID, e.ExpertSlackID)
+		return ViewErrors(map[string]string{blockAnswer: "この質問に回答できるのは転送先の専門家のみです。"}), nil
+	}
+	if e.Status != escalationOpen {
+		return ViewErrors(map[string]string{blockAnswer: "この質問には既に回答済みです。"}), nil
+	}
+
+	ws, expertID := p.Workspace, p.User.ID
+	accepted := runAsync("escalation answer", func(ctx context.Context) {
+		deliverEscalationAnswer(ctx, ws, e, expertID, answer)
+	})
+	if !accepted {
+		return ViewErrors(map[string]string{blockAnswer: busyMessage}), nil
+	}
+	return nil, nil
+}
+
+// deliverEscalationAnswer は回答を記録して質問者のスレッド（なければDM）に届け、専門家へのDMを回答済みにする
+func deliverEscalationAnswer(ctx context.Context, ws *Workspace, e *Escalation, expertID, answer string) {
+	ok, err := escalations.Answer(ctx, e.ID, expertID, answer)
+	if err != nil {
+		log.Printf("Failed to record escalation answer %d: %v", e.ID, err)
+		if err := ws.Client.SendDM(ctx, expertID, "回答の送信に失敗しました。しばらくしてから再度お試しください。"); err != nil {
+			log.Printf("Failed to notify %s: %v", expertID, err)
+		}
+		return
+	}
+	if !ok {
+		if err := ws.Client.SendDM(ctx, expertID, "この質問には既に回答済みです。"); err != nil {
+			log.Printf("Failed to notify %s: %v", expertID, err)
+		}
+		return
+	}
+	e.Status, e.Answer, e.AnsweredBy = escalationAnswered, answer, expertID
+
+	text := fmt.Sprintf("<@%s> さん、専門家の <@%s> さんから質問への回答が届きました。\n%s\n\n%s", e.AskerSlackID, expertID, quoteMrkdwn(e.Question), escapeMrkdwn(answer))
+	if e.ChannelID != "" && e.ThreadTS != "" {
+		_, err = ws.Client.PostMessage(ctx, Message{Channel: e.ChannelID, ThreadTS: e.ThreadTS, Text: text})
+	} else {
+		err = ws.Client.SendDM(ctx, e.AskerSlackID, text)
+	}
+	if err != nil {
+		log.Printf("Failed to relay escalation answer %d to %s: %v", e.ID, e.AskerSlackID, err)
+	}
+
+	if e.ExpertChannelID != "" && e.ExpertMessageTS != "" {
+		msg := Message{Channel: e.ExpertChannelID, Text: "回答を質問者に届けました。", Blocks: escalationBlocks(e, false)}
+		if err := ws.Client.UpdateMessage(ctx, e.ExpertMessageTS, msg); err != nil {
+			log.Printf("Failed to update expert message for escalation %d: %v", e.ID, err)
+		}
+	}
+}
+
+// handleEscalationSave は質問と回答を入力したナレッジ登録モーダルを開く（連携済みの転送先の専門家のみ）
+func handleEscalationSave(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	client := p.Workspace.Client
+	if user, msg := requireAppUser(ctx, p.Workspace, p.User.ID); user == nil {
+		if err := client.SendDM(ctx, p.User.ID, msg); err != nil {
+			log.Printf("Failed to notify %s: %v", p.User.ID, err)
+		}
+		return
+	}
+
+	e, err := loadEscalation(ctx, action.Value)
+	if err != nil {
+		log.Printf("Failed to load escalation: %v", err)
+		return
+	}
+	if e.Status != escalationAnswered || !isEscalationExpert(p, e) {
+		return
+	}
+
+	draft := registerDraft{
+		Title:   truncateRunes(strings.Join(strings.Fields(e.Question), " "), maxTitleRunes),
+		Content: truncateRunes(fmt.Sprintf("Q. %s\n\nA. %s", e.Question, e.Answer), maxContentRunes),
+	}
+	if e.Tag != "" && e.Tag != anyTag {
+		draft.Tags = []string{e.Tag}
+	}
+	if err := openRegisterModal(ctx, client, p.TriggerID, registerModalState{}, draft); err != nil {
+		log.Printf("Failed to open register modal: %v", err)
+	}
+}
+
+// HandleExperts はログイン中のオーナーの組織のタグごとの専門家の一覧（GET）・登録（POST）・削除（DELETE ?id=）を行う
+func HandleExperts(w http.ResponseWriter, r *http.Request) {
+	if escalations == nil {
+		http.Error(w, "Escalations are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		experts, err := escalations.ListExperts(r.Context(), auth.CurrentOrgID(r))
+		if err != nil {
+			log.Printf("Failed to list experts: %v", err)
+			http.Error(w, "Failed to fetch", http.StatusInternalServerError)
+			return
+		}
+		if experts == nil {
+			experts = []Expert{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(experts)
+
+	case http.MethodPost:
+		var e Expert
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+		e.OrgID = auth.CurrentOrgID(r)
+		e.Tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(e.Tag), "#"))
+		e.SlackUserID = strings.TrimSpace(e.SlackUserID)
+		if e.Tag == "" || e.SlackUserID == "" {
+			http.Error(w, "tag and slack_user_id are required", http.StatusBadRequest)
+			return
+		}
+		if err := escalations.SaveExpert(r.Context(), &e); err != nil {
+			log.Printf("Failed to save expert: %v", err)
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+		if err := escalations.DeleteExpert(r.Context(), auth.CurrentOrgID(r), id); err != nil {
+			log.Printf("Failed to delete expert: %v", err)
+			http.Error(w, "Failed to delete", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
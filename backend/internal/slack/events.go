@@ -0,0 +1,195 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// eventEnvelope は Events API のリクエスト
+type eventEnvelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	TeamID    string `json:"team_id"`
+	EventID   string `json:"event_id"`
+	Event     event  `json:"event"`
+	// Authorizations にはこのアプリ（Bot）のユーザーIDが含まれる
+	Authorizations []struct {
+		UserID string `json:"user_id"`
+	} `json:"authorizations"`
+}
+
+// event は Events API の event フィールド（使用する項目のみ）
+type event struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+	// Tab は app_home_opened で開かれたタブ（home / messages）
+	Tab string `json:"tab"`
+	// Tokens は tokens_revoked で失効したトークンの持ち主
+	Tokens struct {
+		Bot []string `json:"bot"`
+	} `json:"tokens"`
+}
+
+// mentionPattern はメッセージ中のユーザーメンション（<@U123> や <@U123|name>）
+var mentionPattern = regexp.MustCompile(`<@[A-Z0-9]+(\|[^>]*)?>`)
+
+// HandleEvents は Slack Events API のリクエストを処理する
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, isValid := ReadAndVerify(r)
+	if !isValid {
+		log.Printf("Invalid Slack signature")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var env eventEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		log.Printf("Failed to parse event: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	switch env.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"challenge": env.Challenge})
+		return
+	case "event_callback":
+		// 応答が遅れると Slack が同じ event_id で再送するため、処理済みのものは応答だけ返す
+		key := "event:" + env.EventID
+		if env.EventID != "" && !seenRequests.claim(key, eventTTL) {
+			requestMetrics.RetriesAcked.Add(1)
+			log.Printf("Acknowledged duplicate event %s (retry %s)", env.EventID, r.Header.Get("X-Slack-Retry-Num"))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		// 3秒以内に応答する必要があるため、処理はワーカープールで行う。
+		// 混み合っている場合はエラーを返し、Slack の再送で処理する
+		if !runAsync("event "+env.Event.Type, func(ctx context.Context) { handleEvent(ctx, env) }) {
+			seenRequests.release(key)
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handleEvent(ctx context.Context, env eventEnvelope) {
+	ev := env.Event
+
+	switch ev.Type {
+	case "app_uninstalled":
+		handleRevoked(ctx, env.TeamID, ev.Type)
+		return
+	case "tokens_revoked":
+		// ユーザートークンのみの失効は Bot に影響しない
+		if len(ev.Tokens.Bot) > 0 {
+			handleRevoked(ctx, env.TeamID, ev.Type)
+		}
+		return
+	}
+
+	if ignoreEvent(env) {
+		return
+	}
+
+	ws, err := resolveWorkspace(ctx, env.TeamID)
+	if err != nil {
+		log.Printf("Failed to resolve workspace %s: %v", env.TeamID, err)
+		return
+	}
+
+	switch {
+	case ev.Type == "app_home_opened":
+		if ev.Tab == "home" {
+			publishHome(ctx, ws, ev.User)
+		}
+	case ev.Type == "app_mention":
+		answerInThread(ctx, ws, ev)
+	case ev.Type == "message" && ev.ChannelType == "im":
+		answerInThread(ctx, ws, ev)
+	}
+}
+
+// handleRevoked はアンインストール・Bot トークンの失効を記録し、以後そのワークスペースのリクエストを処理しない
+func handleRevoked(ctx context.Context, teamID, reason string) {
+	if err := revokeInstallation(ctx, teamID); err != nil {
+		log.Printf("Failed to revoke installation %s: %v", teamID, err)
+		return
+	}
+	log.Printf("Slack installation revoked: team=%s (%s)", teamID, reason)
+}
+
+// ignoreEvent はBot自身や他のBotの投稿、編集・削除などのサブタイプ付きメッセージを無視する
+func ignoreEvent(env eventEnvelope) bool {
+	ev := env.Event
+	if ev.BotID != "" || ev.Subtype != "" || ev.User == "" {
+		return true
+	}
+	for _, a := range env.Authorizations {
+		if a.UserID == ev.User {
+			return true
+		}
+	}
+	return false
+}
+
+// answerInThread は質問に回答し、元のメッセージのスレッドに返信する
+func answerInThread(ctx context.Context, ws *Workspace, ev event) {
+	question := strings.TrimSpace(mentionPattern.ReplaceAllString(ev.Text, ""))
+
+	threadTS := ev.ThreadTS
+	if threadTS == "" {
+		threadTS = ev.TS
+	}
+
+	client := ws.Client
+	if question == "" {
+		if _, err := client.PostMessage(ctx, Message{Channel: ev.Channel, Text: "質問内容を入力してください。", ThreadTS: threadTS}); err != nil {
+			log.Printf("Failed to post reply: %v", err)
+		}
+		return
+	}
+
+	log.Printf("Received %s from %s: %s", ev.Type, ev.User, question)
+
+	reply := "回答生成に失敗しました。"
+	var blocks []map[string]any
+	result, err := ask(ctx, ws.OrgID, question, ev.User)
+	if err != nil {
+		log.Printf("Ask failed: %v", err)
+	} else {
+		// 回答できなかった質問は専門家に転送し、回答はこのスレッドに届ける
+		note := escalate(ctx, ws, question, ev.User, ev.Channel, threadTS, result)
+		if answer := formatAnswer(result); answer != "" {
+			// スレッドの回答は全員に見えているため共有ボタンは付けない
+			reply = answer
+			blocks = withNote(buildAnswerBlocks(question, result, false), note)
+		} else {
+			reply = joinNote("関連ナレッジが見つかりませんでした。", note)
+		}
+	}
+
+	if _, err := client.PostMessage(ctx, Message{Channel: ev.Channel, Text: reply, ThreadTS: threadTS, Blocks: blocks}); err != nil {
+		log.Printf("Failed to post reply: %v", err)
+	}
+}
@@ -1,7 +1,66 @@
 package slack
 
-import "net/http"
+import (
+	"database/sql"
+	"net/http"
+
+	"slack-bot/backend/internal/app"
+	"slack-bot/backend/internal/auth"
+	"slack-bot/backend/internal/knowledge"
+)
+
+// Options は Slack 連携の設定
+type Options struct {
+	// Knowledge はコマンド・メンションの回答やナレッジ登録を処理するサービス
+	Knowledge knowledge.Service
+
+	// Workers は非同期処理を実行するゴルーチン数、QueueSize は処理待ちの上限
+	Workers   int
+	QueueSize int
+
+	// DB を指定するとワークスペースごとのインストール情報（OAuth）を使う
+	DB *sql.DB
+
+	// OAuth インストールに使うアプリの Client ID / Client Secret
+	ClientID     string
+	ClientSecret string
+	// RedirectURL は /slack/oauth/callback の公開URL（アプリ設定の Redirect URL と一致させる）
+	RedirectURL string
+	// Scopes は Bot トークンに要求するスコープ
+	Scopes []string
+
+	// DefaultTeamID・DefaultOrgID は SLACK_BOT_TOKEN で動かす単一ワークスペース構成のワークスペースと組織。
+	// DefaultTeamID 以外の OAuth でインストールされていないワークスペースからのリクエストは受け付けない
+	DefaultTeamID string
+	DefaultOrgID  int64
+
+	// AutoLinkByEmail が有効な場合、メールアドレスが一致する Slack アカウントに自動で連携する
+	AutoLinkByEmail bool
+
+	// Auth はインストールを開始するオーナーの確認に使う
+	Auth *app.App
+}
+
+var slackOptions Options
+
+func RegisterSlackHandlers(corsMiddleware func(http.HandlerFunc) http.HandlerFunc, opts Options) {
+	slackOptions = opts
+	if opts.Workers > 0 || opts.QueueSize > 0 {
+		configureWorkers(opts.Workers, opts.QueueSize)
+	}
+	if opts.DB != nil {
+		installations = &installationStore{db: opts.DB}
+		digests = &digestStore{db: opts.DB}
+		identityConflicts = &identityConflictStore{db: opts.DB}
+		escalations = &escalationStore{db: opts.DB}
+	}
 
-func RegisterSlackHandlers(corsMiddleware func(http.HandlerFunc) http.HandlerFunc) {
 	http.HandleFunc("/slack/commands", corsMiddleware(HandleAskCommand))
+	http.HandleFunc("/slack/events", corsMiddleware(HandleEvents))
+	http.HandleFunc("/slack/interactions", corsMiddleware(HandleInteractions))
+	if opts.Auth != nil {
+		// インストール先の組織はログイン中のオーナーの組織に限る
+		http.HandleFunc("/slack/install", corsMiddleware(auth.RequireOwner(opts.Auth, http.HandlerFunc(HandleInstall)).ServeHTTP))
+		http.HandleFunc("/slack/oauth/callback", corsMiddleware(auth.WithAuth(opts.Auth, http.HandlerFunc(HandleOAuthCallback)).ServeHTTP))
+	}
 }
@@ -0,0 +1,263 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	dbpkg "slack-bot/backend/internal/db"
+	"slack-bot/backend/internal/knowledge"
+)
+
+// App Home のボタンと質問モーダル
+const (
+	actionHomeAsk       = "home_ask"
+	actionHomeRegister  = "home_register"
+	callbackAskQuestion = "ask_question"
+
+	blockQuestion = "question"
+)
+
+// 表示件数・文字数の上限
+const (
+	homeListLimit = 5
+	// homeDraftScanLimit はレビュー待ちを絞り込む前に読み込む下書きの件数
+	homeDraftScanLimit    = 50
+	homeQuestionMaxRunes  = 80
+	maxQuestionInputRunes = 500
+)
+
+func init() {
+	RegisterAction(actionHomeAsk, handleHomeAsk)
+	RegisterAction(actionHomeRegister, handleHomeRegister)
+	RegisterView(callbackAskQuestion, handleAskSubmission)
+}
+
+// publishHome はユーザーの App Home タブを最新の内容で表示する
+func publishHome(ctx context.Context, ws *Workspace, userID string) {
+	if err := ws.Client.PublishView(ctx, userID, buildHomeView(ctx, ws, userID)); err != nil {
+		log.Printf("Failed to publish home for %s: %v", userID, err)
+	}
+}
+
+// buildHomeView は最近の質問・登録したナレッジ・レビュー待ちのナレッジと操作ボタンを並べた Home タブ
+func buildHomeView(ctx context.Context, ws *Workspace, userID string) map[string]any {
+	blocks := []map[string]any{
+		{"type": "header", "text": plainText("ナレッジ ダッシュボード")},
+		{
+			"type": "actions",
+			"elements": []map[string]any{
+				button(actionHomeAsk, "質問する", "", "primary"),
+				button(actionHomeRegister, "ナレッジを登録", "", ""),
+			},
+		},
+		{"type": "divider"},
+		homeSection("最近の質問", recentQuestionLines(userID), "まだ質問していません。"),
+	}
+
+	user, err := appUser(ctx, ws, userID)
+	switch {
+	case err != nil:
+		log.Printf("Failed to resolve app user for %s: %v", userID, err)
+		blocks = append(blocks, contextBlock("ユーザー情報の確認に失敗しました。しばらくしてから開き直してください。"))
+	case user == nil:
+		blocks = append(blocks, contextBlock(fmt.Sprintf("登録したナレッジやレビュー待ちのナレッジを表示するには <%s|連携ページ> で Slack アカウントを連携してください。", bindURL())))
+	default:
+		blocks = append(blocks,
+			homeSection("あなたが登録したナレッジ", authoredLines(user), "登録したナレッジはまだありません。"),
+			homeSection("レビュー待ちのナレッジ", reviewLines(user), "レビュー待ちのナレッジはありません。"),
+		)
+	}
+
+	return map[string]any{
+		"type":   "home",
+		"blocks": blocks,
+	}
+}
+
+func homeSection(title string, lines []string, empty string) map[string]any {
+	text := "*" + title + "*\n"
+	if len(lines) == 0 {
+		text += empty
+	} else {
+		text += strings.Join(lines, "\n")
+	}
+	return map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": text},
+	}
+}
+
+func contextBlock(text string) map[string]any {
+	return map[string]any{
+		"type": "context",
+		"elements": []map[string]any{
+			{"type": "mrkdwn", "text": text},
+		},
+	}
+}
+
+func recentQuestionLines(userID string) []string {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return nil
+	}
+	history, err := svc.RecentQuestions(userID, homeListLimit)
+	if err != nil {
+		log.Printf("Failed to load recent questions for %s: %v", userID, err)
+		return nil
+	}
+
+	lines := make([]string, 0, len(history))
+	for _, h := range history {
+		line := fmt.Sprintf("• %s ｜ %s", escapeMrkdwn(truncateRunes(strings.Join(strings.Fields(h.Question), " "), homeQuestionMaxRunes)), slackDate(h.CreatedAt))
+		if !h.Answered {
+			line += "（未回答）"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func authoredLines(user *dbpkg.User) []string {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return nil
+	}
+	items, err := svc.GetByAuthor(user.ID, homeListLimit)
+	if err != nil {
+		log.Printf("Failed to load authored knowledge for %s: %v", user.ID, err)
+		return nil
+	}
+
+	lines := make([]string, 0, len(items))
+	for _, k := range items {
+		lines = append(lines, "• "+knowledgeListItem(k))
+	}
+	return lines
+}
+
+// reviewLines は公開前の下書き（オーナーには全員分、それ以外には自分の分）
+func reviewLines(user *dbpkg.User) []string {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return nil
+	}
+	drafts, err := svc.ListByStatus(knowledge.StatusDraft, homeDraftScanLimit)
+	if err != nil {
+		log.Printf("Failed to load drafts: %v", err)
+		return nil
+	}
+
+	var lines []string
+	for _, k := range drafts {
+		if !canModify(user, &k) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("• %s ｜ %s", knowledgeLink(k), slackDate(k.UpdatedAt)))
+		if len(lines) >= homeListLimit {
+			break
+		}
+	}
+	return lines
+}
+
+// slackDate は閲覧者のタイムゾーンで表示される日時
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+// handleHomeAsk は質問を入力するモーダルを開く
+func handleHomeAsk(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	if _, err := p.Workspace.Client.OpenView(ctx, p.TriggerID, askModalView()); err != nil {
+		log.Printf("Failed to open ask modal: %v", err)
+	}
+}
+
+// handleHomeRegister はナレッジ登録モーダルを開く（連携済みのユーザーのみ）
+func handleHomeRegister(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	client := p.Workspace.Client
+	if user, msg := requireAppUser(ctx, p.Workspace, p.User.ID); user == nil {
+		if err := client.SendDM(ctx, p.User.ID, msg); err != nil {
+			log.Printf("Failed to notify %s: %v", p.User.ID, err)
+		}
+		return
+	}
+	if err := openRegisterModal(ctx, client, p.TriggerID, registerModalState{}, registerDraft{}); err != nil {
+		log.Printf("Failed to open register modal: %v", err)
+	}
+}
+
+func askModalView() map[string]any {
+	return map[string]any{
+		"type":        "modal",
+		"callback_id": callbackAskQuestion,
+		"title":       plainText("質問する"),
+		"submit":      plainText("質問"),
+		"close":       plainText("キャンセル"),
+		"blocks": []map[string]any{
+			inputBlock(blockQuestion, "質問内容", map[string]any{
+				"type":        "plain_text_input",
+				"action_id":   inputAction,
+				"multiline":   true,
+				"max_length":  maxQuestionInputRunes,
+				"placeholder": plainText("例: 経費精算の締め日は？"),
+			}, false),
+			contextBlock("回答はこのアプリとのDMに届きます。"),
+		},
+	}
+}
+
+// handleAskSubmission はモーダルを閉じ、回答を非同期に生成してDMで届ける
+func handleAskSubmission(ctx context.Context, p *InteractionPayload) (*ViewResponse, error) {
+	question := strings.TrimSpace(p.View.Input(blockQuestion, inputAction))
+	switch {
+	case question == "":
+		return ViewErrors(map[string]string{blockQuestion: "質問内容を入力してください。"}), nil
+	case len([]rune(question)) > maxQuestionInputRunes:
+		return ViewErrors(map[string]string{blockQuestion: fmt.Sprintf("質問は%d文字以内で入力してください。", maxQuestionInputRunes)}), nil
+	}
+
+	ws, userID := p.Workspace, p.User.ID
+	accepted := runAsync("ask from home", func(ctx context.Context) {
+		answerByDM(ctx, ws, userID, question)
+	})
+	if !accepted {
+		return ViewErrors(map[string]string{blockQuestion: busyMessage}), nil
+	}
+	return nil, nil
+}
+
+// answerByDM は質問への回答をDMで送り、Home タブの最近の質問を更新する
+func answerByDM(ctx context.Context, ws *Workspace, userID, question string) {
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+
+	msg := Message{}
+	result, err := ask(ctx, ws.OrgID, question, userID)
+	switch {
+	case err != nil:
+		log.Printf("Ask failed: %v", err)
+		msg.Text = "回答生成に失敗しました。"
+	case formatAnswer(result) == "":
+		msg.Text = joinNote("関連ナレッジが見つかりませんでした。", escalate(ctx, ws, question, userID, "", "", result))
+	default:
+		// DM では共有先のチャンネルがないため共有ボタンは付けない
+		msg.Text = formatAnswer(result)
+		msg.Blocks = withNote(buildAnswerBlocks(question, result, false), escalate(ctx, ws, question, userID, "", "", result))
+	}
+
+	channel, err := ws.Client.OpenConversation(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to open DM with %s: %v", userID, err)
+		return
+	}
+	msg.Channel = channel
+	if _, err := ws.Client.PostMessage(ctx, msg); err != nil {
+		log.Printf("Failed to send answer to %s: %v", userID, err)
+	}
+
+	publishHome(ctx, ws, userID)
+}
@@ -0,0 +1,449 @@
+package slack
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"slack-bot/backend/internal/auth"
+	dbpkg "slack-bot/backend/internal/db"
+)
+
+// 自動連携できなかった理由
+const (
+	// conflictSlackAccountTaken はメールアドレスの Slack アカウントが別のユーザーに連携済み
+	conflictSlackAccountTaken = "slack_account_taken"
+	// conflictBoundElsewhere は手動で連携した Slack アカウントがメールアドレスのものと異なる（手動の連携を優先する）
+	conflictBoundElsewhere = "bound_to_other_account"
+	// conflictAmbiguous はワークスペースごとに別の Slack アカウントが見つかった
+	conflictAmbiguous = "ambiguous_match"
+)
+
+// IdentityConflict は自動連携できなかったユーザー
+type IdentityConflict struct {
+	ID         int64     `json:"id"`
+	UserID     string    `json:"user_id"`
+	Email      string    `json:"email"`
+	SlackID    string    `json:"slack_id"`
+	TeamID     string    `json:"team_id"`
+	Reason     string    `json:"reason"`
+	Detail     string    `json:"detail"`
+	CreatedAt  time.Time `json:"created_at"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// identityConflictStore は slack_identity_conflicts テーブルを扱う
+type identityConflictStore struct {
+	db *sql.DB
+}
+
+// Record は未解決の衝突を記録し、新たに検出したものであれば true を返す
+func (s *identityConflictStore) Record(ctx context.Context, c IdentityConflict) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+	UPDATE slack_identity_conflicts
+	SET detected_at = NOW(), email = $4, team_id = $5, detail = $6
+	WHERE user_id = $1 AND slack_id = $2 AND reason = $3 AND resolved_at IS NULL`,
+		c.UserID, c.SlackID, c.Reason, c.Email, c.TeamID, c.Detail)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return false, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+	INSERT INTO slack_identity_conflicts (user_id, email, slack_id, team_id, reason, detail)
+	VALUES ($1, $2, $3, $4, $5, $6)`,
+		c.UserID, c.Email, c.SlackID, c.TeamID, c.Reason, c.Detail)
+	return err == nil, err
+}
+
+// ListOpen は userIDs の未解決の衝突を新しい順に返す
+func (s *identityConflictStore) ListOpen(ctx context.Context, userIDs []string) ([]IdentityConflict, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, user_id, email, slack_id, team_id, reason, detail, created_at, detected_at
+	FROM slack_identity_conflicts
+	WHERE resolved_at IS NULL AND user_id = ANY($1)
+	ORDER BY created_at DESC`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IdentityConflict
+	for rows.Next() {
+		var c IdentityConflict
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Email, &c.SlackID, &c.TeamID, &c.Reason, &c.Detail, &c.CreatedAt, &c.DetectedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ResolveStale は userIDs の衝突のうち before 以降の同期で検出されなかったものを解決済みにする
+func (s *identityConflictStore) ResolveStale(ctx context.Context, before time.Time, userIDs []string) error {
+	_, err := s.db.ExecContext(ctx, `
+	UPDATE slack_identity_conflicts
+	SET resolved_at = NOW()
+	WHERE resolved_at IS NULL AND detected_at < $1 AND user_id = ANY($2)`, before, pq.Array(userIDs))
+	return err
+}
+
+// identityConflicts は RegisterSlackHandlers で DB が渡された場合に設定される
+var identityConflicts *identityConflictStore
+
+// identitySyncMu は定期実行と管理者による実行が重ならないようにする
+var identitySyncMu sync.Mutex
+
+// errSyncRunning は同期が実行中であることを表す
+var errSyncRunning = errors.New("identity sync is already running")
+
+// errAutoLinkDisabled は SLACK_AUTO_LINK_BY_EMAIL が無効であることを表す
+var errAutoLinkDisabled = errors.New("automatic linking by email is disabled")
+
+// IdentitySyncResult は同期の結果
+type IdentitySyncResult struct {
+	Checked       int `json:"checked"`
+	Linked        int `json:"linked"`
+	AlreadyLinked int `json:"already_linked"`
+	NotFound      int `json:"not_found"`
+	Conflicts     int `json:"conflicts"`
+	NewConflicts  int `json:"new_conflicts"`
+	Errors        int `json:"errors"`
+}
+
+// RunIdentitySync は未連携のユーザーをメールアドレスで Slack アカウントに連携する処理を定期的に実行する
+func RunIdentitySync(ctx context.Context, interval time.Duration) {
+	if identityConflicts == nil || !slackOptions.AutoLinkByEmail {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if result, err := SyncIdentities(ctx); err != nil {
+			log.Printf("Slack identity sync failed: %v", err)
+		} else {
+			log.Printf("Slack identity sync: checked=%d linked=%d conflicts=%d (new %d) not_found=%d errors=%d",
+				result.Checked, result.Linked, result.Conflicts, result.NewConflicts, result.NotFound, result.Errors)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// slackMatch はメールアドレスから見つかった Slack アカウント
+type slackMatch struct {
+	SlackID string
+	TeamID  string
+	ws      *Workspace
+}
+
+// SyncIdentities はすべての組織のユーザーを照合する（定期実行用）
+func SyncIdentities(ctx context.Context) (*IdentitySyncResult, error) {
+	return syncIdentities(ctx, func(int64) bool { return true })
+}
+
+// SyncOrgIdentities は組織のユーザーだけを照合する（オーナーによる実行用）
+func SyncOrgIdentities(ctx context.Context, orgID int64) (*IdentitySyncResult, error) {
+	return syncIdentities(ctx, func(id int64) bool { return id == orgID })
+}
+
+// syncIdentities は inOrg の組織の有効なユーザーのメールアドレスを、同じ組織に紐付いたワークスペースの
+// users.lookupByEmail で照合し、未連携のユーザーを連携する。自動で連携できないものは衝突として記録し、
+// 組織のオーナーに通知する。アプリのメールアドレスは招待の受諾で、Slack のメールアドレスは
+// Slack 側で確認済みのものとして扱う
+func syncIdentities(ctx context.Context, inOrg func(orgID int64) bool) (*IdentitySyncResult, error) {
+	if identityConflicts == nil {
+		return nil, errors.New("identity sync is not configured")
+	}
+	if !slackOptions.AutoLinkByEmail {
+		return nil, errAutoLinkDisabled
+	}
+	if !identitySyncMu.TryLock() {
+		return nil, errSyncRunning
+	}
+	defer identitySyncMu.Unlock()
+
+	started := time.Now()
+	active, err := activeWorkspaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workspaces := map[int64][]*Workspace{}
+	for _, ws := range active {
+		if inOrg(ws.OrgID) {
+			workspaces[ws.OrgID] = append(workspaces[ws.OrgID], ws)
+		}
+	}
+	if len(workspaces) == 0 {
+		return nil, ErrNotInstalled
+	}
+	all, err := dbpkg.ListUsers(ctx, slackOptions.DB)
+	if err != nil {
+		return nil, err
+	}
+	var users []dbpkg.UserRow
+	var userIDs []string
+	for _, u := range all {
+		if inOrg(u.OrgID) {
+			users = append(users, u)
+			userIDs = append(userIDs, u.ID)
+		}
+	}
+
+	result := &IdentitySyncResult{}
+	newConflicts := map[int64][]IdentityConflict{}
+	conflictWS := map[int64]*Workspace{}
+	for _, u := range users {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		// 別の組織のワークスペースのアカウントには連携しない
+		orgWorkspaces := workspaces[u.OrgID]
+		if !u.IsActive || strings.TrimSpace(u.Email) == "" || len(orgWorkspaces) == 0 {
+			continue
+		}
+		result.Checked++
+
+		matches, err := lookupSlackAccounts(ctx, orgWorkspaces, u.Email)
+		if err != nil {
+			log.Printf("Failed to look up Slack account for user %s: %v", u.ID, err)
+			result.Errors++
+			continue
+		}
+
+		conflict, err := linkByEmail(ctx, u, matches, result)
+		if err != nil {
+			log.Printf("Failed to link Slack account for user %s: %v", u.ID, err)
+			result.Errors++
+			continue
+		}
+		if conflict == nil {
+			continue
+		}
+
+		result.Conflicts++
+		isNew, err := identityConflicts.Record(ctx, *conflict)
+		if err != nil {
+			log.Printf("Failed to record identity conflict for user %s: %v", u.ID, err)
+			result.Errors++
+			continue
+		}
+		if isNew {
+			result.NewConflicts++
+			newConflicts[u.OrgID] = append(newConflicts[u.OrgID], *conflict)
+			if conflictWS[u.OrgID] == nil {
+				conflictWS[u.OrgID] = matches[0].ws
+			}
+		}
+	}
+
+	// 一部の照合に失敗した場合は、検出できなかっただけの可能性があるため解決済みにしない
+	if result.Errors == 0 {
+		if err := identityConflicts.ResolveStale(ctx, started, userIDs); err != nil {
+			log.Printf("Failed to resolve stale identity conflicts: %v", err)
+		}
+	}
+	for orgID, conflicts := range newConflicts {
+		notifyOwnersOfConflicts(ctx, orgID, users, workspaces[orgID], conflictWS[orgID], conflicts)
+	}
+	return result, nil
+}
+
+// lookupSlackAccounts は渡されたワークスペースでメールアドレスの Slack アカウントを探す（削除済み・Bot は除く）
+func lookupSlackAccounts(ctx context.Context, workspaces []*Workspace, email string) ([]slackMatch, error) {
+	var matches []slackMatch
+	seen := map[string]bool{}
+	for _, ws := range workspaces {
+		su, err := ws.Client.LookupUserByEmail(ctx, email)
+		if ErrorCode(err) == "users_not_found" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if su.Deleted || su.IsBot || seen[su.ID] {
+			continue
+		}
+		seen[su.ID] = true
+		teamID := su.TeamID
+		if teamID == "" {
+			teamID = ws.TeamID
+		}
+		matches = append(matches, slackMatch{SlackID: su.ID, TeamID: teamID, ws: ws})
+	}
+	return matches, nil
+}
+
+// linkByEmail は見つかった Slack アカウントに連携する。連携できない場合は衝突を返す
+func linkByEmail(ctx context.Context, u dbpkg.UserRow, matches []slackMatch, result *IdentitySyncResult) (*IdentityConflict, error) {
+	conflict := &IdentityConflict{UserID: u.ID, Email: u.Email}
+	switch len(matches) {
+	case 0:
+		result.NotFound++
+		return nil, nil
+	case 1:
+	default:
+		ids := make([]string, 0, len(matches))
+		for _, m := range matches {
+			ids = append(ids, m.SlackID)
+		}
+		sort.Strings(ids)
+		conflict.SlackID = strings.Join(ids, ",")
+		conflict.Reason = conflictAmbiguous
+		conflict.Detail = "複数のワークスペースで別の Slack アカウントが見つかりました"
+		return conflict, nil
+	}
+
+	m := matches[0]
+	conflict.SlackID, conflict.TeamID = m.SlackID, m.TeamID
+
+	if u.SlackID.Valid && u.SlackID.String != "" {
+		if u.SlackID.String == m.SlackID {
+			result.AlreadyLinked++
+			return nil, nil
+		}
+		conflict.Reason = conflictBoundElsewhere
+		conflict.Detail = fmt.Sprintf("手動で %s に連携済み", u.SlackID.String)
+		return conflict, nil
+	}
+
+	owner, err := dbpkg.GetUserBySlackID(ctx, slackOptions.DB, m.SlackID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil && owner.ID != u.ID {
+		conflict.Reason = conflictSlackAccountTaken
+		conflict.Detail = fmt.Sprintf("ユーザー %s に連携済み", owner.ID)
+		return conflict, nil
+	}
+
+	linked, err := dbpkg.LinkUserSlackID(ctx, slackOptions.DB, u.ID, m.SlackID)
+	if err != nil {
+		return nil, err
+	}
+	if linked {
+		result.Linked++
+		log.Printf("Linked user %s to Slack account %s by email", u.ID, m.SlackID)
+	} else {
+		// 照合中に手動で連携された
+		result.AlreadyLinked++
+	}
+	return nil, nil
+}
+
+// notifyOwnersOfConflicts は新たに検出した衝突を、組織のオーナーのうち Slack アカウントを連携済みの人にDMで知らせる
+func notifyOwnersOfConflicts(ctx context.Context, orgID int64, users []dbpkg.UserRow, workspaces []*Workspace, preferred *Workspace, conflicts []IdentityConflict) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Slack アカウントを自動連携できなかったユーザーが%d件あります*\n", len(conflicts))
+	for _, c := range conflicts {
+		fmt.Fprintf(&b, "• %s（%s）: %s\n", escapeMrkdwn(c.Email), c.Reason, escapeMrkdwn(c.Detail))
+	}
+	b.WriteString("詳細は `/api/admin/slack/identity-conflicts` で確認できます。手動での連携は各ユーザーの連携ページから行えます。")
+	msg := b.String()
+
+	// オーナーがどのワークスペースにいるかは分からないため、衝突を検出したワークスペースから順に試す
+	ordered := workspaces
+	if preferred != nil {
+		ordered = append([]*Workspace{preferred}, workspaces...)
+	}
+	for _, u := range users {
+		if u.OrgID != orgID || !u.IsActive || !strings.EqualFold(u.Role, roleOwner) || !u.SlackID.Valid || u.SlackID.String == "" {
+			continue
+		}
+		var err error
+		for _, ws := range ordered {
+			if err = ws.Client.SendDM(ctx, u.SlackID.String, msg); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to notify owner %s of identity conflicts: %v", u.ID, err)
+		}
+	}
+}
+
+// HandleIdentityConflicts はログイン中のオーナーの組織のユーザーの未解決の衝突の一覧を返す
+func HandleIdentityConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if identityConflicts == nil {
+		http.Error(w, "Identity sync is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+	users, err := dbpkg.ListUsers(ctx, slackOptions.DB)
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		http.Error(w, "Failed to fetch", http.StatusInternalServerError)
+		return
+	}
+	orgID := auth.CurrentOrgID(r)
+	var userIDs []string
+	for _, u := range users {
+		if u.OrgID == orgID {
+			userIDs = append(userIDs, u.ID)
+		}
+	}
+
+	conflicts, err := identityConflicts.ListOpen(ctx, userIDs)
+	if err != nil {
+		log.Printf("Failed to list identity conflicts: %v", err)
+		http.Error(w, "Failed to fetch", http.StatusInternalServerError)
+		return
+	}
+	if conflicts == nil {
+		conflicts = []IdentityConflict{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conflicts)
+}
+
+// HandleIdentitySync はログイン中のオーナーの組織の自動連携をすぐに実行し、結果を返す
+func HandleIdentitySync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if identityConflicts == nil {
+		http.Error(w, "Identity sync is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := SyncOrgIdentities(r.Context(), auth.CurrentOrgID(r))
+	switch {
+	case errors.Is(err, errAutoLinkDisabled):
+		http.Error(w, "Automatic linking by email is disabled (SLACK_AUTO_LINK_BY_EMAIL)", http.StatusConflict)
+		return
+	case errors.Is(err, errSyncRunning):
+		http.Error(w, "Identity sync is already running", http.StatusConflict)
+		return
+	case errors.Is(err, ErrNotInstalled):
+		http.Error(w, "Slack app is not installed", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		log.Printf("Slack identity sync failed: %v", err)
+		http.Error(w, "Identity sync failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,214 @@
+package slack
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNotInstalled はワークスペースにアプリがインストールされていない（またはアンインストール済み）ことを表す
+var ErrNotInstalled = errors.New("slack app is not installed in this workspace")
+
+// errInstalledForOtherOrg はワークスペースが別の組織に連携済みであることを表す
+var errInstalledForOtherOrg = errors.New("slack team is installed for another organization")
+
+// Installation は OAuth でインストールされたワークスペース
+type Installation struct {
+	TeamID      string
+	TeamName    string
+	OrgID       int64
+	BotToken    string
+	BotUserID   string
+	Scope       string
+	InstalledBy string
+	InstalledAt time.Time
+	RevokedAt   *time.Time
+}
+
+// installationStore は slack_installations テーブルを扱う
+type installationStore struct {
+	db *sql.DB
+}
+
+// Find は team_id のインストール情報を返す（なければ nil）
+func (s *installationStore) Find(ctx context.Context, teamID string) (*Installation, error) {
+	var inst Installation
+	var installedBy sql.NullString
+	var revokedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+	SELECT team_id, team_name, org_id, bot_token, bot_user_id, scope, installed_by, installed_at, revoked_at
+	FROM slack_installations
+	WHERE team_id = $1`, teamID).Scan(&inst.TeamID, &inst.TeamName, &inst.OrgID, &inst.BotToken,
+		&inst.BotUserID, &inst.Scope, &installedBy, &inst.InstalledAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	inst.InstalledBy = installedBy.String
+	if revokedAt.Valid {
+		inst.RevokedAt = &revokedAt.Time
+	}
+	return &inst, nil
+}
+
+// FindByOrg は組織に紐付いた有効なインストール情報を返す（なければ nil）
+func (s *installationStore) FindByOrg(ctx context.Context, orgID int64) (*Installation, error) {
+	var teamID string
+	err := s.db.QueryRowContext(ctx, `
+	SELECT team_id FROM slack_installations
+	WHERE org_id = $1 AND revoked_at IS NULL
+	ORDER BY installed_at DESC
+	LIMIT 1`, orgID).Scan(&teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Find(ctx, teamID)
+}
+
+// ListActive は有効なインストール情報を新しい順に返す
+func (s *installationStore) ListActive(ctx context.Context) ([]Installation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT team_id, team_name, org_id, bot_token, bot_user_id
+	FROM slack_installations
+	WHERE revoked_at IS NULL
+	ORDER BY installed_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Installation
+	for rows.Next() {
+		var inst Installation
+		if err := rows.Scan(&inst.TeamID, &inst.TeamName, &inst.OrgID, &inst.BotToken, &inst.BotUserID); err != nil {
+			return nil, err
+		}
+		out = append(out, inst)
+	}
+	return out, rows.Err()
+}
+
+// Save はインストール情報を保存する（再インストールの場合はトークンを更新して有効に戻す）。
+// 有効なインストールを別の組織に付け替えることはできない
+func (s *installationStore) Save(ctx context.Context, inst *Installation) error {
+	res, err := s.db.ExecContext(ctx, `
+	INSERT INTO slack_installations (team_id, team_name, org_id, bot_token, bot_user_id, scope, installed_by)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+	ON CONFLICT (team_id) DO UPDATE SET
+		team_name = EXCLUDED.team_name,
+		org_id = EXCLUDED.org_id,
+		bot_token = EXCLUDED.bot_token,
+		bot_user_id = EXCLUDED.bot_user_id,
+		scope = EXCLUDED.scope,
+		installed_by = EXCLUDED.installed_by,
+		installed_at = NOW(),
+		revoked_at = NULL
+	WHERE slack_installations.org_id = EXCLUDED.org_id OR slack_installations.revoked_at IS NOT NULL`,
+		inst.TeamID, inst.TeamName, inst.OrgID, inst.BotToken, inst.BotUserID, inst.Scope, inst.InstalledBy)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errInstalledForOtherOrg
+	}
+	return nil
+}
+
+// Revoke はアンインストール・トークン失効を記録し、保存していたトークンを消す
+func (s *installationStore) Revoke(ctx context.Context, teamID string) error {
+	_, err := s.db.ExecContext(ctx, `
+	UPDATE slack_installations
+	SET revoked_at = NOW(), bot_token = ''
+	WHERE team_id = $1 AND revoked_at IS NULL`, teamID)
+	return err
+}
+
+// installations は RegisterSlackHandlers で DB が渡された場合に設定される
+var installations *installationStore
+
+// Workspace はリクエスト元のワークスペースと、対応する組織・Bot トークンのクライアント
+type Workspace struct {
+	TeamID string
+	OrgID  int64
+	Client *Client
+}
+
+// resolveWorkspace は team_id からワークスペースを解決する。
+// OAuth でインストールされていないワークスペースは、SLACK_DEFAULT_TEAM_ID のものに限り
+// SLACK_BOT_TOKEN による単一ワークスペース構成として扱う
+func resolveWorkspace(ctx context.Context, teamID string) (*Workspace, error) {
+	if installations != nil && teamID != "" {
+		inst, err := installations.Find(ctx, teamID)
+		if err != nil {
+			return nil, err
+		}
+		if inst != nil {
+			if inst.RevokedAt != nil {
+				return nil, ErrNotInstalled
+			}
+			return &Workspace{TeamID: teamID, OrgID: inst.OrgID, Client: tokenClient(inst.BotToken)}, nil
+		}
+	}
+
+	client := DefaultClient()
+	if client.token == "" || slackOptions.DefaultTeamID == "" || teamID != slackOptions.DefaultTeamID {
+		return nil, ErrNotInstalled
+	}
+	return &Workspace{TeamID: teamID, OrgID: slackOptions.DefaultOrgID, Client: client}, nil
+}
+
+// workspaceForOrg は組織に紐付いたワークスペースを返す（定期投稿など、リクエスト元がない処理で使う）
+func workspaceForOrg(ctx context.Context, orgID int64) (*Workspace, error) {
+	if installations != nil {
+		inst, err := installations.FindByOrg(ctx, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if inst != nil {
+			return &Workspace{TeamID: inst.TeamID, OrgID: orgID, Client: tokenClient(inst.BotToken)}, nil
+		}
+	}
+
+	client := DefaultClient()
+	if client.token == "" || slackOptions.DefaultTeamID == "" || orgID != slackOptions.DefaultOrgID {
+		return nil, ErrNotInstalled
+	}
+	return &Workspace{TeamID: slackOptions.DefaultTeamID, OrgID: orgID, Client: client}, nil
+}
+
+// activeWorkspaces はインストール済みのすべてのワークスペースを返す（SLACK_BOT_TOKEN の単一ワークスペース構成を含む）
+func activeWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	var out []*Workspace
+	tokens := map[string]bool{}
+	if installations != nil {
+		insts, err := installations.ListActive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range insts {
+			tokens[inst.BotToken] = true
+			out = append(out, &Workspace{TeamID: inst.TeamID, OrgID: inst.OrgID, Client: tokenClient(inst.BotToken)})
+		}
+	}
+
+	if client := DefaultClient(); client.token != "" && slackOptions.DefaultTeamID != "" && !tokens[client.token] {
+		out = append(out, &Workspace{TeamID: slackOptions.DefaultTeamID, OrgID: slackOptions.DefaultOrgID, Client: client})
+	}
+	return out, nil
+}
+
+// revokeInstallation はアンインストール・トークン失効のイベントを記録する
+func revokeInstallation(ctx context.Context, teamID string) error {
+	if installations == nil || teamID == "" {
+		return nil
+	}
+	return installations.Revoke(ctx, teamID)
+}
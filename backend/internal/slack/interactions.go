@@ -0,0 +1,322 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"slack-bot/backend/internal/knowledge"
+)
+
+// InteractionPayload は /slack/interactions に届くペイロード（使用する項目のみ）
+type InteractionPayload struct {
+	// Type は block_actions / view_submission / view_closed / shortcut / message_action
+	Type        string `json:"type"`
+	CallbackID  string `json:"callback_id"`
+	TriggerID   string `json:"trigger_id"`
+	ResponseURL string `json:"response_url"`
+	User        struct {
+		ID     string `json:"id"`
+		TeamID string `json:"team_id"`
+	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	// Message はメッセージショートカット・メッセージ上のボタンの対象
+	Message struct {
+		TS       string `json:"ts"`
+		ThreadTS string `json:"thread_ts"`
+		Text     string `json:"text"`
+		User     string `json:"user"`
+	} `json:"message"`
+	Actions []BlockAction `json:"actions"`
+	View    View          `json:"view"`
+
+	// Workspace はリクエスト元のワークスペース（HandleInteractions が設定する）
+	Workspace *Workspace `json:"-"`
+}
+
+// BlockAction は押されたボタンなどの操作
+type BlockAction struct {
+	ActionID string `json:"action_id"`
+	BlockID  string `json:"block_id"`
+	Value    string `json:"value"`
+}
+
+// View はモーダルの状態
+type View struct {
+	ID              string `json:"id"`
+	CallbackID      string `json:"callback_id"`
+	PrivateMetadata string `json:"private_metadata"`
+	State           struct {
+		// Values は block_id → action_id → 入力値
+		Values map[string]map[string]ViewInput `json:"values"`
+	} `json:"state"`
+}
+
+// ViewInput はモーダルの入力要素の値
+type ViewInput struct {
+	Type           string `json:"type"`
+	Value          string `json:"value"`
+	SelectedOption *struct {
+		Value string `json:"value"`
+	} `json:"selected_option"`
+	SelectedOptions []struct {
+		Value string `json:"value"`
+	} `json:"selected_options"`
+}
+
+// Input returns the value of the input element in blockID (text or selected option)
+func (v View) Input(blockID, actionID string) string {
+	in, ok := v.State.Values[blockID][actionID]
+	if !ok {
+		return ""
+	}
+	if in.SelectedOption != nil {
+		return in.SelectedOption.Value
+	}
+	return in.Value
+}
+
+// ViewResponse は view_submission への応答（nil ならモーダルを閉じる）
+type ViewResponse struct {
+	ResponseAction string            `json:"response_action"`
+	Errors         map[string]string `json:"errors,omitempty"`
+	View           map[string]any    `json:"view,omitempty"`
+}
+
+// ViewErrors はモーダルの入力欄（block_id）ごとにエラーを表示する応答
+func ViewErrors(errors map[string]string) *ViewResponse {
+	return &ViewResponse{ResponseAction: "errors", Errors: errors}
+}
+
+// ActionHandler はボタンなどの操作を処理する（ACK 後に呼ばれる）
+type ActionHandler func(ctx context.Context, p *InteractionPayload, action BlockAction)
+
+// ViewHandler はモーダルの送信を処理する（3秒以内に応答を返す必要がある）
+type ViewHandler func(ctx context.Context, p *InteractionPayload) (*ViewResponse, error)
+
+// ShortcutHandler はグローバル/メッセージショートカットを処理する（ACK 後に呼ばれる）
+type ShortcutHandler func(ctx context.Context, p *InteractionPayload)
+
+// dispatcher は action_id / callback_id ごとに登録されたハンドラへ振り分ける
+type dispatcher struct {
+	mu        sync.RWMutex
+	actions   map[string]ActionHandler
+	views     map[string]ViewHandler
+	shortcuts map[string]ShortcutHandler
+}
+
+var interactions = &dispatcher{
+	actions:   map[string]ActionHandler{},
+	views:     map[string]ViewHandler{},
+	shortcuts: map[string]ShortcutHandler{},
+}
+
+// RegisterAction はボタンなどの action_id にハンドラを登録する
+func RegisterAction(actionID string, h ActionHandler) {
+	interactions.mu.Lock()
+	defer interactions.mu.Unlock()
+	interactions.actions[actionID] = h
+}
+
+// RegisterView はモーダルの callback_id に送信ハンドラを登録する
+func RegisterView(callbackID string, h ViewHandler) {
+	interactions.mu.Lock()
+	defer interactions.mu.Unlock()
+	interactions.views[callbackID] = h
+}
+
+// RegisterShortcut はショートカットの callback_id にハンドラを登録する
+func RegisterShortcut(callbackID string, h ShortcutHandler) {
+	interactions.mu.Lock()
+	defer interactions.mu.Unlock()
+	interactions.shortcuts[callbackID] = h
+}
+
+func init() {
+	RegisterAction(actionAnswerHelpful, handleAnswerFeedback)
+	RegisterAction(actionAnswerNotHelpful, handleAnswerFeedback)
+	RegisterAction(actionAnswerShare, handleAnswerShare)
+}
+
+// HandleInteractions は Slack のボタン・モーダル・ショートカットのリクエストを処理する
+func HandleInteractions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, isValid := ReadAndVerify(r)
+	if !isValid {
+		log.Printf("Invalid Slack signature")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var p InteractionPayload
+	if err := json.Unmarshal([]byte(r.PostFormValue("payload")), &p); err != nil {
+		log.Printf("Failed to parse interaction payload: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	teamID := p.Team.ID
+	if teamID == "" {
+		teamID = p.User.TeamID
+	}
+	ws, err := resolveWorkspace(r.Context(), teamID)
+	if err != nil {
+		log.Printf("Failed to resolve workspace %s: %v", teamID, err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	p.Workspace = ws
+
+	switch p.Type {
+	case "block_actions":
+		w.WriteHeader(http.StatusOK)
+		for _, action := range p.Actions {
+			h := interactions.action(action.ActionID)
+			if h == nil {
+				log.Printf("No handler for action: %s", action.ActionID)
+				continue
+			}
+			if !runAsync("action "+action.ActionID, func(ctx context.Context) { h(ctx, &p, action) }) && p.ResponseURL != "" {
+				sendErrorResponse(p.ResponseURL, busyMessage)
+			}
+		}
+
+	case "view_submission":
+		h := interactions.view(p.View.CallbackID)
+		if h == nil {
+			log.Printf("No handler for view: %s", p.View.CallbackID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2500*time.Millisecond)
+		defer cancel()
+		resp, err := h(ctx, &p)
+		if err != nil {
+			// エラーを返すと Slack がモーダルを閉じずにエラー表示する
+			log.Printf("View %s failed: %v", p.View.CallbackID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if resp == nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	case "shortcut", "message_action":
+		w.WriteHeader(http.StatusOK)
+		h := interactions.shortcut(p.CallbackID)
+		if h == nil {
+			log.Printf("No handler for shortcut: %s", p.CallbackID)
+			return
+		}
+		if !runAsync("shortcut "+p.CallbackID, func(ctx context.Context) { h(ctx, &p) }) {
+			if err := p.Workspace.Client.SendDM(r.Context(), p.User.ID, busyMessage); err != nil {
+				log.Printf("Failed to notify %s: %v", p.User.ID, err)
+			}
+		}
+
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (d *dispatcher) action(id string) ActionHandler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.actions[id]
+}
+
+func (d *dispatcher) view(id string) ViewHandler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.views[id]
+}
+
+func (d *dispatcher) shortcut(id string) ShortcutHandler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.shortcuts[id]
+}
+
+// runAsync は ACK 後の処理をワーカープールで実行する。混み合っていて受け付けられなかった場合は false を返す
+func runAsync(name string, fn func(ctx context.Context)) bool {
+	if p := workerPoolForSubmit(); p == nil || !p.Submit(name, fn) {
+		requestMetrics.BusyRejected.Add(1)
+		log.Printf("Slack worker pool is busy, rejected %s", name)
+		return false
+	}
+	return true
+}
+
+// handleAnswerFeedback は回答の「役に立った / 役に立たなかった」を記録する
+func handleAnswerFeedback(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	ref, err := parseAnswerRef(action.Value)
+	if err != nil {
+		log.Printf("Invalid answer reference: %v", err)
+		return
+	}
+
+	helpful := action.ActionID == actionAnswerHelpful
+	err = recordFeedback(knowledge.AnswerFeedback{
+		OrgID:        p.Workspace.OrgID,
+		Question:     ref.Question,
+		KnowledgeIDs: ref.KnowledgeIDs,
+		Helpful:      helpful,
+		UserID:       p.User.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to record feedback: %v", err)
+		sendErrorResponse(p.ResponseURL, "フィードバックの送信に失敗しました。")
+		return
+	}
+
+	msg := "フィードバックありがとうございます。"
+	if !helpful {
+		msg += "回答の改善に役立てます。"
+	}
+	sendResponse(p.ResponseURL, map[string]any{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             msg,
+	})
+}
+
+// handleAnswerShare は本人にのみ表示された回答をチャンネルに投稿する
+func handleAnswerShare(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	ref, err := parseAnswerRef(action.Value)
+	if err != nil || ref.Answer == "" {
+		log.Printf("Invalid answer reference: %v", err)
+		sendErrorResponse(p.ResponseURL, "回答を共有できませんでした。")
+		return
+	}
+
+	sendResponse(p.ResponseURL, map[string]any{
+		"response_type":    "in_channel",
+		"replace_original": false,
+		"text":             fmt.Sprintf("%s\n（質問: %s）", ref.Answer, ref.Question),
+		"blocks":           buildSharedAnswerBlocks(ref, p.User.ID),
+	})
+	// 共有済みの本人向けメッセージは消す
+	sendResponse(p.ResponseURL, map[string]any{"delete_original": true})
+}
@@ -0,0 +1,396 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	dbpkg "slack-bot/backend/internal/db"
+	"slack-bot/backend/internal/knowledge"
+)
+
+// /kb コマンドのボタン・モーダル
+const (
+	actionKBDelete        = "kb_delete"
+	callbackEditKnowledge = "edit_knowledge"
+)
+
+// 表示件数・文字数の上限
+const (
+	kbSearchLimit     = 5
+	kbListLimit       = 20
+	kbShowMaxRunes    = 2500
+	kbSnippetMaxRunes = 80
+)
+
+// roleOwner は全てのナレッジを編集・削除できるロール
+const roleOwner = "OWNER"
+
+const kbHelp = "*`/kb` の使い方*\n" +
+	"• `/kb search キーワード` - ナレッジを検索\n" +
+	"• `/kb show ID` - ナレッジの内容を表示\n" +
+	"• `/kb list mine` - 自分が登録したナレッジの一覧\n" +
+	"• `/kb edit ID` - ナレッジを編集（作成者・オーナーのみ）\n" +
+	"• `/kb delete ID` - ナレッジを削除（作成者・オーナーのみ）\n" +
+	"• `/kb help` - このヘルプ"
+
+func init() {
+	RegisterAction(actionKBDelete, handleKBDelete)
+	RegisterView(callbackEditKnowledge, handleEditSubmission)
+}
+
+// parseKBCommand はサブコマンドと引数に分ける
+func parseKBCommand(text string) (string, string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "help", ""
+	}
+	sub := strings.ToLower(fields[0])
+	return sub, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), fields[0]))
+}
+
+// handleKBCommand は /kb のサブコマンドを実行し、結果を本人にのみ表示する（edit は HandleAskCommand で同期的に処理する）
+func handleKBCommand(ctx context.Context, ws *Workspace, text, userID, responseURL string) {
+	sub, arg := parseKBCommand(text)
+
+	var msg string
+	var blocks []map[string]any
+	switch sub {
+	case "search":
+		msg = kbSearch(ctx, ws.OrgID, arg)
+	case "show":
+		msg = kbShow(ctx, ws, userID, arg)
+	case "list":
+		msg = kbListMine(ctx, ws, userID, arg)
+	case "delete":
+		msg, blocks = kbConfirmDelete(ctx, ws, userID, arg)
+	case "help":
+		msg = kbHelp
+	default:
+		msg = fmt.Sprintf("不明なサブコマンドです: `%s`\n\n%s", sub, kbHelp)
+	}
+
+	payload := map[string]any{
+		"response_type": "ephemeral",
+		"text":          msg,
+	}
+	if blocks != nil {
+		payload["blocks"] = blocks
+	}
+	sendResponse(responseURL, payload)
+}
+
+func kbSearch(ctx context.Context, orgID int64, query string) string {
+	if query == "" {
+		return "検索キーワードを入力してください: `/kb search キーワード`"
+	}
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return "検索に失敗しました。"
+	}
+
+	results, err := svc.SearchSimilar(ctx, orgID, query, kbSearchLimit)
+	if err != nil {
+		log.Printf("KB search failed: %v", err)
+		return "検索に失敗しました。"
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("「%s」に一致するナレッジは見つかりませんでした。", escapeMrkdwn(query))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*「%s」の検索結果*\n", escapeMrkdwn(query))
+	for _, k := range results {
+		fmt.Fprintf(&b, "• %s", knowledgeLink(k))
+		if snippet := kbSnippet(k); snippet != "" {
+			fmt.Fprintf(&b, " - %s", escapeMrkdwn(snippet))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func kbShow(ctx context.Context, ws *Workspace, userID, arg string) string {
+	k, msg := kbLookup(arg, "show")
+	if k == nil {
+		return msg
+	}
+	if k.Visibility == knowledge.VisibilityPrivate {
+		user, err := appUser(ctx, ws, userID)
+		if err != nil {
+			log.Printf("Failed to resolve app user for %s: %v", userID, err)
+		}
+		if !canModify(user, k) {
+			return "このナレッジは非公開です。"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*\n", knowledgeLink(*k))
+	b.WriteString(escapeMrkdwn(truncateRunes(k.Content, kbShowMaxRunes)))
+	b.WriteString("\n\n")
+	if len(k.Tags) > 0 {
+		fmt.Fprintf(&b, "タグ: %s ｜ ", escapeMrkdwn(strings.Join(k.Tags, ", ")))
+	}
+	fmt.Fprintf(&b, "登録日: %s", k.CreatedAt.Format("2006-01-02"))
+	if k.Visibility == knowledge.VisibilityPrivate {
+		b.WriteString(" ｜ 非公開")
+	}
+	if k.SourceURL != "" {
+		fmt.Fprintf(&b, " ｜ <%s|出典>", k.SourceURL)
+	}
+	return b.String()
+}
+
+func kbListMine(ctx context.Context, ws *Workspace, userID, arg string) string {
+	if arg != "mine" {
+		return "使い方: `/kb list mine`"
+	}
+	user, msg := requireAppUser(ctx, ws, userID)
+	if user == nil {
+		return msg
+	}
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return "一覧の取得に失敗しました。"
+	}
+
+	items, err := svc.GetByAuthor(user.ID, kbListLimit)
+	if err != nil {
+		log.Printf("KB list failed: %v", err)
+		return "一覧の取得に失敗しました。"
+	}
+	if len(items) == 0 {
+		return "登録したナレッジはまだありません。"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*あなたが登録したナレッジ（新しい順に最大%d件）*\n", kbListLimit)
+	for _, k := range items {
+		b.WriteString("• " + knowledgeListItem(k) + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// kbConfirmDelete は削除の確認ボタンを返す（削除は handleKBDelete で行う）
+func kbConfirmDelete(ctx context.Context, ws *Workspace, userID, arg string) (string, []map[string]any) {
+	k, user, msg := kbModifiable(ctx, ws, userID, arg, "delete")
+	if k == nil || user == nil {
+		return msg, nil
+	}
+
+	text := fmt.Sprintf("ナレッジ %s を削除しますか？", knowledgeLink(*k))
+	deleteButton := button(actionKBDelete, "削除する", strconv.Itoa(k.ID), "danger")
+	deleteButton["confirm"] = map[string]any{
+		"title":   plainText("ナレッジの削除"),
+		"text":    plainText(fmt.Sprintf("「%s」を削除します。元に戻せません。", truncateRunes(k.Title, 100))),
+		"confirm": plainText("削除"),
+		"deny":    plainText("キャンセル"),
+		"style":   "danger",
+	}
+	return text, []map[string]any{
+		{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": text},
+		},
+		{
+			"type":     "actions",
+			"elements": []map[string]any{deleteButton},
+		},
+	}
+}
+
+// handleKBDelete は確認ボタンが押されたナレッジを削除する（権限は押した時点で改めて確認する）
+func handleKBDelete(ctx context.Context, p *InteractionPayload, action BlockAction) {
+	k, user, msg := kbModifiable(ctx, p.Workspace, p.User.ID, action.Value, "delete")
+	if k == nil || user == nil {
+		sendErrorResponse(p.ResponseURL, msg)
+		return
+	}
+
+	if err := slackOptions.Knowledge.Delete(k.ID); err != nil {
+		log.Printf("Failed to delete knowledge %d: %v", k.ID, err)
+		sendErrorResponse(p.ResponseURL, "ナレッジの削除に失敗しました。")
+		return
+	}
+
+	log.Printf("Knowledge %d deleted by %s via Slack", k.ID, user.ID)
+	sendResponse(p.ResponseURL, map[string]any{
+		"replace_original": true,
+		"text":             fmt.Sprintf("ナレッジ「%s」（#%d）を削除しました。", escapeMrkdwn(k.Title), k.ID),
+	})
+}
+
+// editModalState は編集モーダルの private_metadata
+type editModalState struct {
+	ID          int    `json:"id"`
+	ResponseURL string `json:"response_url,omitempty"`
+}
+
+// openEditModal は編集モーダルを開く。開けなかった場合は本人に表示するメッセージを返す
+func openEditModal(ctx context.Context, ws *Workspace, userID, arg, triggerID, responseURL string) string {
+	k, user, msg := kbModifiable(ctx, ws, userID, arg, "edit")
+	if k == nil || user == nil {
+		return msg
+	}
+
+	view := editModalView(k, editModalState{ID: k.ID, ResponseURL: responseURL})
+	if _, err := ws.Client.OpenView(ctx, triggerID, view); err != nil {
+		log.Printf("Failed to open edit modal: %v", err)
+		return "編集フォームを開けませんでした。"
+	}
+	return ""
+}
+
+// editModalView は登録済みの内容を入力したナレッジ編集モーダル
+func editModalView(k *knowledge.Knowledge, state editModalState) map[string]any {
+	view := registerModalView(registerModalState{SourceURL: k.SourceURL}, registerDraft{
+		Title:   k.Title,
+		Content: truncateRunes(k.Content, maxContentRunes),
+		Tags:    k.Tags,
+	})
+	metadata, _ := json.Marshal(state)
+
+	// 重複チェックの選択肢は登録時のみ使う
+	var blocks []map[string]any
+	for _, b := range view["blocks"].([]map[string]any) {
+		switch b["block_id"] {
+		case blockForce:
+			continue
+		case blockVisibility:
+			element := b["element"].(map[string]any)
+			for _, opt := range visibilityOptions() {
+				if opt["value"] == k.Visibility {
+					element["initial_option"] = opt
+				}
+			}
+		}
+		blocks = append(blocks, b)
+	}
+
+	view["blocks"] = blocks
+	view["callback_id"] = callbackEditKnowledge
+	view["private_metadata"] = string(metadata)
+	view["title"] = plainText(fmt.Sprintf("ナレッジを編集 #%d", k.ID))
+	view["submit"] = plainText("保存")
+	return view
+}
+
+// handleEditSubmission は入力を検証し、権限を確認してから非同期に更新する
+func handleEditSubmission(ctx context.Context, p *InteractionPayload) (*ViewResponse, error) {
+	in, _, errs := parseRegisterSubmission(p.View)
+	if len(errs) > 0 {
+		return ViewErrors(errs), nil
+	}
+
+	var state editModalState
+	if err := json.Unmarshal([]byte(p.View.PrivateMetadata), &state); err != nil {
+		return nil, fmt.Errorf("invalid edit modal metadata: %w", err)
+	}
+
+	k, user, msg := kbModifiable(ctx, p.Workspace, p.User.ID, strconv.Itoa(state.ID), "edit")
+	if k == nil || user == nil {
+		return ViewErrors(map[string]string{blockTitle: msg}), nil
+	}
+
+	k.Title = in.Title
+	k.Content = in.Content
+	k.Tags = in.Tags
+	if k.Tags == nil {
+		// 空にした場合も既存のタグを残さないよう空配列で更新する
+		k.Tags = []string{}
+	}
+	k.Visibility = in.Visibility
+
+	updated := *k
+	userID, client, orgID := p.User.ID, p.Workspace.Client, p.Workspace.OrgID
+	accepted := runAsync("edit knowledge", func(ctx context.Context) {
+		msg := fmt.Sprintf("ナレッジ %s を更新しました。", knowledgeLink(updated))
+		if err := slackOptions.Knowledge.Update(ctx, orgID, updated); err != nil {
+			log.Printf("Failed to update knowledge %d: %v", updated.ID, err)
+			msg = "ナレッジの更新に失敗しました。"
+		}
+		notifyUser(ctx, client, userID, registerModalState{ResponseURL: state.ResponseURL}, msg)
+	})
+	if !accepted {
+		return ViewErrors(map[string]string{blockContent: busyMessage}), nil
+	}
+	return nil, nil
+}
+
+// kbLookup は引数のIDのナレッジを返す（統合済みのIDは統合先）。見つからない場合はメッセージを返す
+func kbLookup(arg, sub string) (*knowledge.Knowledge, string) {
+	id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(arg), "#"))
+	if err != nil || id <= 0 {
+		return nil, fmt.Sprintf("ナレッジのIDを指定してください: `/kb %s ID`", sub)
+	}
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return nil, "ナレッジを取得できませんでした。"
+	}
+
+	k, err := svc.GetByID(id)
+	if err != nil {
+		if newID, rerr := svc.ResolveRedirect(id); rerr == nil {
+			k, err = svc.GetByID(newID)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("ナレッジ #%d は見つかりませんでした。", id)
+	}
+	return k, ""
+}
+
+// kbModifiable は編集・削除できるナレッジと操作するユーザーを返す。できない場合はメッセージを返す
+func kbModifiable(ctx context.Context, ws *Workspace, slackID, arg, sub string) (*knowledge.Knowledge, *dbpkg.User, string) {
+	user, msg := requireAppUser(ctx, ws, slackID)
+	if user == nil {
+		return nil, nil, msg
+	}
+	k, msg := kbLookup(arg, sub)
+	if k == nil {
+		return nil, nil, msg
+	}
+	if !canModify(user, k) {
+		return nil, nil, "このナレッジを変更できるのは作成者とオーナーのみです。"
+	}
+	return k, user, ""
+}
+
+// canModify は作成者またはオーナーであれば true を返す
+func canModify(user *dbpkg.User, k *knowledge.Knowledge) bool {
+	if user == nil {
+		return false
+	}
+	return strings.EqualFold(user.Role, roleOwner) || k.CreatedBy == user.ID
+}
+
+func knowledgeLink(k knowledge.Knowledge) string {
+	return fmt.Sprintf("<%s|#%d %s>", knowledgeURL(k.ID), k.ID, escapeMrkdwn(k.Title))
+}
+
+// knowledgeListItem は一覧の1行（下書き・非公開であれば添える）
+func knowledgeListItem(k knowledge.Knowledge) string {
+	s := knowledgeLink(k)
+	if k.Status == knowledge.StatusDraft {
+		s += "（下書き）"
+	}
+	if k.Visibility == knowledge.VisibilityPrivate {
+		s += "（非公開）"
+	}
+	return s
+}
+
+func kbSnippet(k knowledge.Knowledge) string {
+	s := k.Snippet
+	if s == "" {
+		s = k.Summary
+	}
+	if s == "" {
+		s = k.Content
+	}
+	return truncateRunes(strings.Join(strings.Fields(s), " "), kbSnippetMaxRunes)
+}
@@ -0,0 +1,31 @@
+package slack
+
+import "testing"
+
+func TestParseKBCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantSub string
+		wantArg string
+	}{
+		{"empty shows help", "", "help", ""},
+		{"blank shows help", "   ", "help", ""},
+		{"subcommand only", "search", "search", ""},
+		{"subcommand and argument", "show 12", "show", "12"},
+		{"subcommand is case-insensitive", "SEARCH vpn", "search", "vpn"},
+		{"surrounding spaces are trimmed", "  list   mine  ", "list", "mine"},
+		{"inner spaces of the argument are kept", "search 経費  精算", "search", "経費  精算"},
+		{"full-width space separates", "search　経費精算", "search", "経費精算"},
+		{"multi-line argument", "search VPN\n設定", "search", "VPN\n設定"},
+		{"unknown subcommand is returned as is", "Foo bar", "foo", "bar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, arg := parseKBCommand(tt.text)
+			if sub != tt.wantSub || arg != tt.wantArg {
+				t.Errorf("parseKBCommand(%q) = (%q, %q), want (%q, %q)", tt.text, sub, arg, tt.wantSub, tt.wantArg)
+			}
+		})
+	}
+}
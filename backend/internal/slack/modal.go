@@ -0,0 +1,282 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ナレッジ登録モーダルの callback_id と入力欄の block_id / action_id
+const (
+	callbackRegisterKnowledge = "register_knowledge"
+
+	blockTitle      = "title"
+	blockContent    = "content"
+	blockTags       = "tags"
+	blockVisibility = "visibility"
+	blockForce      = "force"
+	inputAction     = "input"
+)
+
+// 入力値の上限
+const (
+	maxTitleRunes   = 100
+	maxContentRunes = 3000
+	maxTags         = 10
+	maxTagRunes     = 30
+)
+
+// registerModalState はモーダルの private_metadata に保持する呼び出し元の情報
+type registerModalState struct {
+	ResponseURL string `json:"response_url,omitempty"`
+	ChannelID   string `json:"channel_id,omitempty"`
+	// SourceURL は出典（スレッドから登録する場合のパーマリンク）
+	SourceURL string `json:"source_url,omitempty"`
+}
+
+// registerDraft はモーダルの初期値
+type registerDraft struct {
+	Title   string
+	Content string
+	Tags    []string
+}
+
+func init() {
+	RegisterView(callbackRegisterKnowledge, handleRegisterSubmission)
+}
+
+// openRegisterModal はナレッジ登録モーダルを開く
+func openRegisterModal(ctx context.Context, client *Client, triggerID string, state registerModalState, draft registerDraft) error {
+	_, err := client.OpenView(ctx, triggerID, registerModalView(state, draft))
+	return err
+}
+
+// registerModalView はタイトル・本文・タグ・公開範囲を入力するモーダル
+func registerModalView(state registerModalState, draft registerDraft) map[string]any {
+	metadata, _ := json.Marshal(state)
+
+	var blocks []map[string]any
+	if state.SourceURL != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "context",
+			"elements": []map[string]any{
+				{"type": "mrkdwn", "text": fmt.Sprintf("出典: <%s|Slack スレッド>", state.SourceURL)},
+			},
+		})
+	}
+	blocks = append(blocks,
+		inputBlock(blockTitle, "タイトル", map[string]any{
+			"type":          "plain_text_input",
+			"action_id":     inputAction,
+			"max_length":    maxTitleRunes,
+			"initial_value": draft.Title,
+		}, false),
+		inputBlock(blockContent, "本文", map[string]any{
+			"type":          "plain_text_input",
+			"action_id":     inputAction,
+			"multiline":     true,
+			"max_length":    maxContentRunes,
+			"initial_value": draft.Content,
+		}, false),
+		inputBlock(blockTags, "タグ（カンマ区切り）", map[string]any{
+			"type":          "plain_text_input",
+			"action_id":     inputAction,
+			"placeholder":   plainText("例: 経費, 申請"),
+			"initial_value": strings.Join(draft.Tags, ", "),
+		}, true),
+		inputBlock(blockVisibility, "公開範囲", map[string]any{
+			"type":           "static_select",
+			"action_id":      inputAction,
+			"initial_option": visibilityOptions()[0],
+			"options":        visibilityOptions(),
+		}, false),
+		inputBlock(blockForce, "重複チェック", map[string]any{
+			"type":      "checkboxes",
+			"action_id": inputAction,
+			"options": []map[string]any{
+				{"text": plainText("類似するナレッジがあっても登録する"), "value": "true"},
+			},
+		}, true),
+	)
+
+	return map[string]any{
+		"type":             "modal",
+		"callback_id":      callbackRegisterKnowledge,
+		"private_metadata": string(metadata),
+		"title":            plainText("ナレッジを登録"),
+		"submit":           plainText("登録"),
+		"close":            plainText("キャンセル"),
+		"blocks":           blocks,
+	}
+}
+
+func visibilityOptions() []map[string]any {
+	return []map[string]any{
+		{"text": plainText("全体に公開"), "value": "public"},
+		{"text": plainText("自分のみ（検索・回答に使わない）"), "value": "private"},
+	}
+}
+
+func inputBlock(blockID, label string, element map[string]any, optional bool) map[string]any {
+	if v, ok := element["initial_value"].(string); ok && v == "" {
+		delete(element, "initial_value")
+	}
+	return map[string]any{
+		"type":     "input",
+		"block_id": blockID,
+		"label":    plainText(label),
+		"element":  element,
+		"optional": optional,
+	}
+}
+
+func plainText(text string) map[string]any {
+	return map[string]any{"type": "plain_text", "text": text, "emoji": true}
+}
+
+// handleRegisterSubmission は入力を検証し、問題なければモーダルを閉じて非同期に登録する
+func handleRegisterSubmission(ctx context.Context, p *InteractionPayload) (*ViewResponse, error) {
+	in, force, errs := parseRegisterSubmission(p.View)
+	if len(errs) > 0 {
+		return ViewErrors(errs), nil
+	}
+
+	user, err := appUser(ctx, p.Workspace, p.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return ViewErrors(map[string]string{blockTitle: "Slack アカウントが連携されていません。" + bindURL() + " で連携してから登録してください。"}), nil
+	}
+	in.CreatedBy = user.ID
+	in.OrgID = p.Workspace.OrgID
+
+	var state registerModalState
+	if p.View.PrivateMetadata != "" {
+		if err := json.Unmarshal([]byte(p.View.PrivateMetadata), &state); err != nil {
+			log.Printf("Invalid modal metadata: %v", err)
+		}
+	}
+
+	// 登録（要約・Embedding生成）は3秒を超えうるため、モーダルを閉じてから行う
+	userID, client := p.User.ID, p.Workspace.Client
+	accepted := runAsync("register knowledge", func(ctx context.Context) {
+		registerFromModal(ctx, client, in, force, userID, state)
+	})
+	if !accepted {
+		// モーダルを閉じずに入力内容を残す
+		return ViewErrors(map[string]string{blockContent: busyMessage}), nil
+	}
+	return nil, nil
+}
+
+// parseRegisterSubmission は入力値を取り出し、入力欄ごとのエラーを返す
+func parseRegisterSubmission(v View) (knowledgeInput, bool, map[string]string) {
+	errs := map[string]string{}
+
+	in := knowledgeInput{
+		Title:      strings.TrimSpace(v.Input(blockTitle, inputAction)),
+		Content:    strings.TrimSpace(v.Input(blockContent, inputAction)),
+		Visibility: v.Input(blockVisibility, inputAction),
+	}
+
+	switch {
+	case in.Title == "":
+		errs[blockTitle] = "タイトルを入力してください。"
+	case len([]rune(in.Title)) > maxTitleRunes:
+		errs[blockTitle] = fmt.Sprintf("タイトルは%d文字以内で入力してください。", maxTitleRunes)
+	case strings.ContainsAny(in.Title, "\r\n"):
+		errs[blockTitle] = "タイトルに改行は使えません。"
+	}
+
+	switch {
+	case in.Content == "":
+		errs[blockContent] = "本文を入力してください。"
+	case len([]rune(in.Content)) > maxContentRunes:
+		errs[blockContent] = fmt.Sprintf("本文は%d文字以内で入力してください。", maxContentRunes)
+	}
+
+	tags, tagErr := parseTags(v.Input(blockTags, inputAction))
+	if tagErr != "" {
+		errs[blockTags] = tagErr
+	}
+	in.Tags = tags
+
+	if in.Visibility != "public" && in.Visibility != "private" {
+		errs[blockVisibility] = "公開範囲を選択してください。"
+	}
+
+	force := false
+	if input, ok := v.State.Values[blockForce][inputAction]; ok {
+		force = len(input.SelectedOptions) > 0
+	}
+
+	return in, force, errs
+}
+
+// parseTags はカンマ（全角・読点も可）区切りのタグを重複を除いて返す
+func parseTags(raw string) ([]string, string) {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '、' || r == '，' || r == '\n'
+	})
+
+	var tags []string
+	seen := map[string]bool{}
+	for _, t := range fields {
+		t = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len([]rune(t)) > maxTagRunes {
+			return nil, fmt.Sprintf("タグは1つ%d文字以内で入力してください。", maxTagRunes)
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Sprintf("タグは%d個までです。", maxTags)
+	}
+	return tags, ""
+}
+
+// registerFromModal はモーダルの内容を登録し、結果を呼び出し元（なければDM）に通知する
+func registerFromModal(ctx context.Context, client *Client, in knowledgeInput, force bool, userID string, state registerModalState) {
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+
+	in.SourceURL = state.SourceURL
+
+	var msg string
+	result, err := registerKnowledge(ctx, in, force)
+	switch {
+	case err != nil:
+		log.Printf("Failed to register knowledge: %v", err)
+		msg = "ナレッジ登録に失敗しました。"
+	case result.Conflict:
+		msg = conflictMessage(result)
+		if result.RequiresConfirmation {
+			msg += "\nそれでも登録する場合は、フォームの「類似するナレッジがあっても登録する」にチェックして再度登録してください。"
+		}
+	default:
+		msg = registeredMessage(in.Title, result)
+	}
+
+	notifyUser(ctx, client, userID, state, msg)
+}
+
+// notifyUser はコマンドの response_url があれば本人にのみ、なければDMで通知する
+func notifyUser(ctx context.Context, client *Client, userID string, state registerModalState, msg string) {
+	if state.ResponseURL != "" {
+		sendResponse(state.ResponseURL, map[string]any{
+			"response_type": "ephemeral",
+			"text":          msg,
+		})
+		return
+	}
+	if err := client.SendDM(ctx, userID, msg); err != nil {
+		log.Printf("Failed to notify %s: %v", userID, err)
+	}
+}
@@ -0,0 +1,190 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"slack-bot/backend/internal/auth"
+)
+
+// slackAuthorizeURL は OAuth v2 の認可画面
+const slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+// oauthStateTTL はインストール開始から認可完了までの有効期限
+const oauthStateTTL = 10 * time.Minute
+
+// HandleInstall はログイン中のオーナーの組織をインストール先として Slack の認可画面にリダイレクトする
+func HandleInstall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if slackOptions.ClientID == "" || slackOptions.ClientSecret == "" || installations == nil {
+		http.Error(w, "Slack OAuth is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	user := auth.CurrentUser(r)
+	if user == nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	state, err := signOAuthState(user.ID, user.OrgID, time.Now().Add(oauthStateTTL))
+	if err != nil {
+		log.Printf("Failed to create OAuth state: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	q := url.Values{
+		"client_id": {slackOptions.ClientID},
+		"scope":     {strings.Join(slackOptions.Scopes, ",")},
+		"state":     {state},
+	}
+	if slackOptions.RedirectURL != "" {
+		q.Set("redirect_uri", slackOptions.RedirectURL)
+	}
+	http.Redirect(w, r, slackAuthorizeURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// HandleOAuthCallback は認可コードを Bot トークンに交換し、ワークスペースを組織に紐付けて保存する。
+// インストールを開始したユーザー本人のセッションでのみ受け付ける
+func HandleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if installations == nil {
+		http.Error(w, "Slack OAuth is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		// ユーザーが認可画面でキャンセルした場合など
+		log.Printf("Slack OAuth was not completed: %s", e)
+		http.Error(w, "Slack のインストールがキャンセルされました。", http.StatusBadRequest)
+		return
+	}
+
+	userID, orgID, err := verifyOAuthState(q.Get("state"), time.Now())
+	if err != nil {
+		log.Printf("Invalid OAuth state: %v", err)
+		http.Error(w, "インストールの有効期限が切れました。もう一度お試しください。", http.StatusBadRequest)
+		return
+	}
+	if userID != auth.CurrentUserID(r) {
+		log.Printf("OAuth state was issued to user %s but completed by %q", userID, auth.CurrentUserID(r))
+		http.Error(w, "インストールを開始したユーザーでログインしてください。", http.StatusForbidden)
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		http.Error(w, "missing code", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	access, err := tokenClient("").OAuthV2Access(ctx, slackOptions.ClientID, slackOptions.ClientSecret, code, slackOptions.RedirectURL)
+	if err != nil {
+		log.Printf("Failed to exchange OAuth code: %v", err)
+		http.Error(w, "Slack のインストールに失敗しました。", http.StatusBadGateway)
+		return
+	}
+	if access.AccessToken == "" || access.Team.ID == "" {
+		log.Printf("OAuth response has no bot token (team %q)", access.Team.ID)
+		http.Error(w, "Slack のインストールに失敗しました。", http.StatusBadGateway)
+		return
+	}
+
+	inst := &Installation{
+		TeamID:      access.Team.ID,
+		TeamName:    access.Team.Name,
+		OrgID:       orgID,
+		BotToken:    access.AccessToken,
+		BotUserID:   access.BotUserID,
+		Scope:       access.Scope,
+		InstalledBy: access.AuthedUser.ID,
+	}
+	err = installations.Save(ctx, inst)
+	if errors.Is(err, errInstalledForOtherOrg) {
+		log.Printf("Refused to move Slack team %s to org %d: %v", inst.TeamID, inst.OrgID, err)
+		http.Error(w, "このワークスペースは別の組織に連携されています。先に Slack 側でアプリをアンインストールしてください。", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save Slack installation: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Slack app installed: team=%s org=%d by user %s", inst.TeamID, inst.OrgID, userID)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Slack ワークスペース「%s」にインストールしました。このウィンドウを閉じて Slack に戻ってください。\n", inst.TeamName)
+}
+
+// signOAuthState はインストールを開始したユーザー・組織IDと有効期限を Client Secret で署名した
+// state を作る（user.org.expires.nonce.signature、user は base64url）
+func signOAuthState(userID string, orgID int64, expires time.Time) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := fmt.Sprintf("%s.%d.%d.%s", base64.RawURLEncoding.EncodeToString([]byte(userID)), orgID, expires.Unix(),
+		base64.RawURLEncoding.EncodeToString(nonce))
+	return payload + "." + oauthStateMAC(payload), nil
+}
+
+// verifyOAuthState は state の署名と有効期限を確認し、ユーザーIDと組織IDを返す
+func verifyOAuthState(state string, now time.Time) (string, int64, error) {
+	i := strings.LastIndex(state, ".")
+	if i < 0 {
+		return "", 0, fmt.Errorf("malformed state")
+	}
+	payload, sig := state[:i], state[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(oauthStateMAC(payload))) {
+		return "", 0, fmt.Errorf("state signature mismatch")
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 4 {
+		return "", 0, fmt.Errorf("malformed state")
+	}
+	userID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(userID) == 0 {
+		return "", 0, fmt.Errorf("malformed state: invalid user")
+	}
+	orgID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed state: %w", err)
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed state: %w", err)
+	}
+	if now.Unix() > expires {
+		return "", 0, fmt.Errorf("state expired")
+	}
+	return string(userID), orgID, nil
+}
+
+func oauthStateMAC(payload string) string {
+	mac := hmac.New(sha256.New, []byte(slackOptions.ClientSecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,98 @@
+package slack
+
+import (
+	"context"
+	"errors"
+
+	"slack-bot/backend/internal/knowledge"
+)
+
+// errNoKnowledgeService は Options.Knowledge が設定されていないことを表す
+var errNoKnowledgeService = errors.New("knowledge service is not configured")
+
+// ask は質問に回答する
+func ask(ctx context.Context, orgID int64, question, userID string) (*knowledge.AskResult, error) {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return nil, errNoKnowledgeService
+	}
+	return svc.Ask(ctx, knowledge.AskRequest{Question: question, OrgID: orgID, AskedBy: userID})
+}
+
+// knowledgeInput は Slack から登録するナレッジの内容
+type knowledgeInput struct {
+	Title      string
+	Content    string
+	Tags       []string
+	Visibility string
+	SourceURL  string
+	// CreatedBy は作成者（連携済みのアプリのユーザーID）
+	CreatedBy string
+	// OrgID は登録元のワークスペースの組織
+	OrgID int64
+}
+
+// registrationResult はナレッジ登録の結果
+type registrationResult struct {
+	ID             int
+	SuggestedTitle string
+	Duplicates     []knowledge.Duplicate
+	// Conflict は類似ナレッジがあるため登録されなかったことを示す
+	Conflict bool
+	// RequiresConfirmation は確認すれば登録できることを示す（Conflict の場合のみ）
+	RequiresConfirmation bool
+}
+
+// registerKnowledge はナレッジを登録する（confirmed なら重複候補の確認を省略する）
+func registerKnowledge(ctx context.Context, in knowledgeInput, confirmed bool) (*registrationResult, error) {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return nil, errNoKnowledgeService
+	}
+
+	visibility := in.Visibility
+	if visibility == "" {
+		visibility = knowledge.VisibilityPublic
+	}
+	createdBy := in.CreatedBy
+	if createdBy == "" {
+		createdBy = "user"
+	}
+	k := knowledge.Knowledge{
+		Title:      in.Title,
+		Content:    in.Content,
+		Tags:       in.Tags,
+		Visibility: visibility,
+		SourceURL:  in.SourceURL,
+		CreatedBy:  createdBy,
+	}
+
+	id, duplicates, err := svc.CreateWithDuplicateCheck(ctx, in.OrgID, k, confirmed)
+	var dupErr *knowledge.DuplicateError
+	if errors.As(err, &dupErr) {
+		return &registrationResult{
+			Duplicates:           dupErr.Duplicates,
+			Conflict:             true,
+			RequiresConfirmation: !dupErr.Blocked,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &registrationResult{ID: id, Duplicates: duplicates}
+	// タイトル案は保存時に生成される
+	if created, err := svc.GetByID(id); err == nil {
+		result.SuggestedTitle = created.SuggestedTitle
+	}
+	return result, nil
+}
+
+// recordFeedback は回答の評価を記録する
+func recordFeedback(f knowledge.AnswerFeedback) error {
+	svc := slackOptions.Knowledge
+	if svc == nil {
+		return errNoKnowledgeService
+	}
+	return svc.RecordFeedback(f)
+}
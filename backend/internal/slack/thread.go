@@ -0,0 +1,145 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// callbackSaveThread は「スレッドをナレッジに保存」メッセージショートカットの callback_id
+const callbackSaveThread = "save_thread"
+
+func init() {
+	RegisterShortcut(callbackSaveThread, handleSaveThread)
+}
+
+// threadSummaryEnabled はスレッドを要約してフォームに入力するかどうか（SLACK_THREAD_SUMMARY、既定で有効）
+func threadSummaryEnabled() bool {
+	return os.Getenv("SLACK_THREAD_SUMMARY") != "false"
+}
+
+// handleSaveThread は選択したメッセージのスレッドを集めて登録モーダルに入力する
+func handleSaveThread(ctx context.Context, p *InteractionPayload) {
+	client := p.Workspace.Client
+
+	// 登録できるのは連携済みのユーザーのみ
+	if user, msg := requireAppUser(ctx, p.Workspace, p.User.ID); user == nil {
+		if p.ResponseURL != "" {
+			sendErrorResponse(p.ResponseURL, msg)
+		} else if err := client.SendDM(ctx, p.User.ID, msg); err != nil {
+			log.Printf("Failed to notify %s: %v", p.User.ID, err)
+		}
+		return
+	}
+
+	// trigger_id は3秒で失効するため、先に読み込み中のモーダルを開いてから内容を差し替える
+	viewID, err := client.OpenView(ctx, p.TriggerID, loadingView("スレッドを読み込んでいます…"))
+	if err != nil {
+		log.Printf("Failed to open thread modal: %v", err)
+		return
+	}
+
+	threadTS := p.Message.ThreadTS
+	if threadTS == "" {
+		threadTS = p.Message.TS
+	}
+
+	messages, err := client.ConversationReplies(ctx, p.Channel.ID, threadTS)
+	if err != nil {
+		log.Printf("Failed to fetch thread %s: %v", threadTS, err)
+		// チャンネルに参加していない場合などは取得できない
+		if err := client.UpdateView(ctx, viewID, loadingView("スレッドを取得できませんでした。ボットをチャンネルに追加してから再度お試しください。")); err != nil {
+			log.Printf("Failed to update thread modal: %v", err)
+		}
+		return
+	}
+
+	permalink, err := client.Permalink(ctx, p.Channel.ID, threadTS)
+	if err != nil {
+		log.Printf("Failed to get permalink: %v", err)
+	}
+
+	draft := threadDraft(ctx, p.Workspace, messages)
+	state := registerModalState{ChannelID: p.Channel.ID, SourceURL: permalink}
+	if err := client.UpdateView(ctx, viewID, registerModalView(state, draft)); err != nil {
+		log.Printf("Failed to update thread modal: %v", err)
+	}
+}
+
+// threadDraft はスレッドの発言をまとめた本文と、要約が有効ならタイトル・要約・キーワードを入力した初期値を返す
+func threadDraft(ctx context.Context, ws *Workspace, messages []ThreadMessage) registerDraft {
+	names := map[string]string{}
+	var b strings.Builder
+	for _, m := range messages {
+		text := strings.TrimSpace(m.Text)
+		if text == "" {
+			continue
+		}
+		author := "bot"
+		if m.User != "" {
+			author = userName(ctx, ws.Client, names, m.User)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", author, text)
+	}
+	transcript := strings.TrimSpace(b.String())
+
+	draft := registerDraft{Content: transcript}
+	if len(messages) > 0 {
+		draft.Title = truncateRunes(firstLine(messages[0].Text), maxTitleRunes)
+	}
+
+	if svc := slackOptions.Knowledge; svc != nil && threadSummaryEnabled() && transcript != "" {
+		// スレッドの発言も組織の伏せ字ルールを適用してから外部AIに送る
+		meta, err := svc.GenerateMetadata(ctx, ws.OrgID, draft.Title, transcript)
+		if err != nil {
+			log.Printf("Thread summary failed: %v", err)
+		} else {
+			if meta.Title != "" {
+				draft.Title = meta.Title
+			}
+			if meta.Summary != "" {
+				draft.Content = meta.Summary + "\n\n---\n" + transcript
+			}
+			draft.Tags = meta.Keywords
+		}
+	}
+
+	draft.Content = truncateRunes(draft.Content, maxContentRunes)
+	return draft
+}
+
+// userName はユーザーIDを表示名に変換する（取得できなければIDのまま）。names は同じスレッド内のキャッシュ
+func userName(ctx context.Context, client *Client, names map[string]string, userID string) string {
+	if name, ok := names[userID]; ok {
+		return name
+	}
+	name := userID
+	if u, err := client.UserInfo(ctx, userID); err != nil {
+		log.Printf("Failed to get user %s: %v", userID, err)
+	} else {
+		name = u.DisplayName()
+	}
+	names[userID] = name
+	return name
+}
+
+// loadingView は処理中・エラーの表示用モーダル
+func loadingView(message string) map[string]any {
+	return map[string]any{
+		"type":  "modal",
+		"title": plainText("ナレッジを登録"),
+		"close": plainText("閉じる"),
+		"blocks": []map[string]any{
+			{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": message},
+			},
+		},
+	}
+}
+
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(s), "\n", 2)[0])
+}
@@ -0,0 +1,56 @@
+package slack
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	dbpkg "slack-bot/backend/internal/db"
+)
+
+// slackBindPath は Slack アカウントを連携する Web アプリのページ
+const slackBindPath = "/onboarding/slack-bind"
+
+// appUser は Slack ユーザーIDを連携済みのアプリのユーザーに解決する。
+// 連携されていない、無効化された、またはワークスペースと別の組織のユーザーの場合は nil を返す
+func appUser(ctx context.Context, ws *Workspace, slackID string) (*dbpkg.User, error) {
+	if slackOptions.DB == nil {
+		return nil, errors.New("user directory is not configured")
+	}
+	u, err := dbpkg.GetUserBySlackID(ctx, slackOptions.DB, slackID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive || u.OrgID != ws.OrgID {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// bindURL は Slack アカウントの連携ページのURL
+func bindURL() string {
+	return webAppURL() + slackBindPath
+}
+
+// bindPrompt は未連携のユーザーに連携ページを案内するメッセージ
+func bindPrompt() string {
+	return fmt.Sprintf("この操作には Slack アカウントの連携が必要です。<%s|連携ページ> で連携してから再度お試しください。", bindURL())
+}
+
+// requireAppUser は連携済みのユーザーを返す。未連携の場合は nil と案内メッセージを返す
+func requireAppUser(ctx context.Context, ws *Workspace, slackID string) (*dbpkg.User, string) {
+	u, err := appUser(ctx, ws, slackID)
+	if err != nil {
+		log.Printf("Failed to resolve app user for %s: %v", slackID, err)
+		return nil, "ユーザー情報の確認に失敗しました。しばらくしてから再度お試しください。"
+	}
+	if u == nil {
+		return nil, bindPrompt()
+	}
+	return u, ""
+}
@@ -9,16 +9,25 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
+
+	"slack-bot/backend/internal/security"
 )
 
+// maxClockSkew はリクエストのタイムスタンプとして許容する現在時刻とのずれ（リプレイ攻撃対策）
+const maxClockSkew = 5 * time.Minute
+
 func verifySlackRequest(r *http.Request, body []byte) bool {
-	signingSecret := os.Getenv("SLACK_SIGNING_SECRET")
-	if signingSecret == "" {
-		log.Printf("SLACK_SIGNING_SECRET not set, skipping verification")
-		return true // 開発環境では検証をスキップ
+	secrets := security.SlackSigningSecrets()
+	if len(secrets) == 0 {
+		// 署名シークレットがなければ拒否する。検証の省略は明示した開発モードのみ
+		if security.SlackVerificationDisabled() {
+			log.Printf("Slack signature verification is disabled (development mode)")
+			return true
+		}
+		log.Printf("Slack signing secret is not configured, rejecting request")
+		return false
 	}
 
 	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
@@ -33,30 +42,30 @@ func verifySlackRequest(r *http.Request, body []byte) bool {
 		return false
 	}
 
-	// タイムスタンプの検証（リプレイ攻撃対策）
+	// タイムスタンプの検証（リプレイ攻撃対策）。未来の日時も拒否する
 	ts, err := strconv.ParseInt(timestamp, 10, 64)
 	if err != nil {
 		log.Printf("Invalid timestamp format: %s", timestamp)
 		return false
 	}
-
-	if time.Now().Unix()-ts > 300 { // 5分以内
-		log.Printf("Request timestamp too old: %d", ts)
+	if skew := time.Since(time.Unix(ts, 0)); skew > maxClockSkew || skew < -maxClockSkew {
+		log.Printf("Request timestamp out of range: %d (skew %s)", ts, skew.Round(time.Second))
 		return false
 	}
 
-	// 署名検証
+	// 署名検証（ローテーション中は新旧いずれかのシークレットで一致すればよい）
 	basestring := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
-	mac := hmac.New(sha256.New, []byte(signingSecret))
-	mac.Write([]byte(basestring))
-	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
-
-	isValid := hmac.Equal([]byte(expected), []byte(sig))
-	if !isValid {
-		log.Printf("Signature verification failed. Expected: %s, Got: %s", expected, sig)
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(basestring))
+		expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+		if hmac.Equal([]byte(expected), []byte(sig)) {
+			return true
+		}
 	}
 
-	return isValid
+	log.Printf("Signature verification failed (timestamp %s)", timestamp)
+	return false
 }
 
 // ヘルパー: リクエストボディを読み込んで検証
@@ -70,5 +79,31 @@ func ReadAndVerify(r *http.Request) ([]byte, bool) {
 	// 読み込んだので戻しておく（他で使うため）
 	r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-	return body, verifySlackRequest(r, body)
+	if !verifySlackRequest(r, body) {
+		return body, false
+	}
+	if !claimRequest(r) {
+		return body, false
+	}
+	return body, true
+}
+
+// claimRequest は同じ署名のリクエストが既に処理されていれば拒否する（リプレイ攻撃対策）。
+// Slack の再送は署名が変わるため、イベントの再送は event_id で判定する
+func claimRequest(r *http.Request) bool {
+	requestMetrics.Received.Add(1)
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		requestMetrics.RetriesReceived.Add(1)
+	}
+
+	sig := r.Header.Get("X-Slack-Signature")
+	if sig == "" {
+		return true
+	}
+	if !seenRequests.claim("sig:"+sig, signatureTTL) {
+		requestMetrics.ReplaysRejected.Add(1)
+		log.Printf("Rejected replayed Slack request (timestamp %s)", r.Header.Get("X-Slack-Request-Timestamp"))
+		return false
+	}
+	return true
 }
@@ -0,0 +1,188 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slackSignature は Slack と同じ方法で計算した署名
+func slackSignature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackRequest(t *testing.T) {
+	const (
+		oldSecret = "0123456789abcdef0123456789abcdef"
+		newSecret = "fedcba9876543210fedcba9876543210"
+		body      = "token=x&team_id=T1&command=%2Fask&text=hello"
+	)
+	now := time.Now()
+	unix := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		secret    string // 署名に使うシークレット（空なら署名を付けない）
+		timestamp string // 空ならヘッダーを付けない
+		body      string // 署名後に差し替える本文（空なら body のまま）
+		want      bool
+	}{
+		{
+			name:      "signed with the new secret",
+			env:       map[string]string{"SLACK_SIGNING_SECRETS": newSecret + "," + oldSecret},
+			secret:    newSecret,
+			timestamp: unix(0),
+			want:      true,
+		},
+		{
+			name:      "signed with the old secret during rotation",
+			env:       map[string]string{"SLACK_SIGNING_SECRETS": newSecret, "SLACK_SIGNING_SECRET": oldSecret},
+			secret:    oldSecret,
+			timestamp: unix(0),
+			want:      true,
+		},
+		{
+			name:      "old secret after rotation",
+			env:       map[string]string{"SLACK_SIGNING_SECRETS": newSecret},
+			secret:    oldSecret,
+			timestamp: unix(0),
+			want:      false,
+		},
+		{
+			name:      "timestamp within the allowed skew",
+			env:       map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			secret:    newSecret,
+			timestamp: unix(-4 * time.Minute),
+			want:      true,
+		},
+		{
+			name:      "stale timestamp",
+			env:       map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			secret:    newSecret,
+			timestamp: unix(-6 * time.Minute),
+			want:      false,
+		},
+		{
+			name:      "future timestamp",
+			env:       map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			secret:    newSecret,
+			timestamp: unix(6 * time.Minute),
+			want:      false,
+		},
+		{
+			name:      "invalid timestamp",
+			env:       map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			secret:    newSecret,
+			timestamp: "yesterday",
+			want:      false,
+		},
+		{
+			name:   "missing timestamp header",
+			env:    map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			secret: newSecret,
+			want:   false,
+		},
+		{
+			name:      "missing signature header",
+			env:       map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			timestamp: unix(0),
+			want:      false,
+		},
+		{
+			name:      "tampered body",
+			env:       map[string]string{"SLACK_SIGNING_SECRET": newSecret},
+			secret:    newSecret,
+			timestamp: unix(0),
+			body:      "token=x&team_id=T2&command=%2Fask&text=hello",
+			want:      false,
+		},
+		{
+			name:      "no secret configured",
+			secret:    newSecret,
+			timestamp: unix(0),
+			want:      false,
+		},
+		{
+			name:      "skip verification without ENVIRONMENT",
+			env:       map[string]string{"SLACK_SKIP_VERIFICATION": "true"},
+			timestamp: unix(0),
+			want:      false,
+		},
+		{
+			name:      "skip verification in production",
+			env:       map[string]string{"SLACK_SKIP_VERIFICATION": "true", "ENVIRONMENT": "production"},
+			timestamp: unix(0),
+			want:      false,
+		},
+		{
+			name:      "skip verification in development",
+			env:       map[string]string{"SLACK_SKIP_VERIFICATION": "true", "ENVIRONMENT": "development"},
+			timestamp: unix(0),
+			want:      true,
+		},
+		{
+			name:      "skip verification is ignored when a secret is configured",
+			env:       map[string]string{"SLACK_SKIP_VERIFICATION": "true", "ENVIRONMENT": "development", "SLACK_SIGNING_SECRET": newSecret},
+			secret:    oldSecret,
+			timestamp: unix(0),
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"SLACK_SIGNING_SECRETS", "SLACK_SIGNING_SECRET", "SLACK_SKIP_VERIFICATION", "ENVIRONMENT"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			sent := body
+			if tt.body != "" {
+				sent = tt.body
+			}
+			r := httptest.NewRequest(http.MethodPost, "/slack/commands", strings.NewReader(sent))
+			if tt.timestamp != "" {
+				r.Header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			}
+			if tt.secret != "" {
+				r.Header.Set("X-Slack-Signature", slackSignature(tt.secret, tt.timestamp, body))
+			}
+
+			if got := verifySlackRequest(r, []byte(sent)); got != tt.want {
+				t.Errorf("verifySlackRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAndVerifyRejectsReplay(t *testing.T) {
+	t.Setenv("SLACK_SIGNING_SECRET", testSigningSecret)
+	t.Setenv("SLACK_SIGNING_SECRETS", "")
+	useDedupeStore(t)
+
+	const body = "token=x&team_id=T1&command=%2Fask&text=hello"
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want bool
+	}{
+		{"first request", signedRequest("/slack/commands", body, now), true},
+		{"same signature replayed", signedRequest("/slack/commands", body, now), false},
+		{"new timestamp is a new request", signedRequest("/slack/commands", body, now.Add(-time.Second)), true},
+	}
+	for _, tt := range tests {
+		if _, got := ReadAndVerify(tt.req); got != tt.want {
+			t.Errorf("%s: ReadAndVerify() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package slack
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ワーカープールの既定値（RegisterSlackHandlers の Options で変更できる）
+const (
+	defaultWorkers   = 8
+	defaultQueueSize = 100
+	// jobTimeout は1件の処理（回答生成・登録など）の上限
+	jobTimeout = 30 * time.Second
+)
+
+// busyMessage は処理待ちが上限に達しているときの返信
+const busyMessage = "現在混み合っています。しばらくしてから再度お試しください。"
+
+// workerPool は ACK 後の処理を決まった数のゴルーチンで実行する
+type workerPool struct {
+	jobs chan poolJob
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	// ctx はシャットダウンの猶予を過ぎたときに実行中の処理を打ち切るために使う
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type poolJob struct {
+	name string
+	fn   func(ctx context.Context)
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if queueSize < 0 {
+		queueSize = defaultQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &workerPool{
+		jobs:   make(chan poolJob, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+func (p *workerPool) run(job poolJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic in slack %s: %v", job.name, r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(p.ctx, jobTimeout)
+	defer cancel()
+	job.fn(ctx)
+}
+
+// Submit は処理をキューに入れる。キューが一杯、またはシャットダウン中の場合は false を返す
+func (p *workerPool) Submit(name string, fn func(ctx context.Context)) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.jobs <- poolJob{name: name, fn: fn}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown は新しい処理の受付を止め、キューに残った処理の完了を待つ。
+// ctx が先に終わった場合は実行中の処理をキャンセルして ctx のエラーを返す
+func (p *workerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// workers は Slack からのリクエストの非同期処理を実行する。
+// パッケージの初期化時にはゴルーチンを起動せず、最初の処理の受付時に設定された数で起動する
+var workers = &lazyWorkerPool{size: defaultWorkers, queueSize: defaultQueueSize}
+
+type lazyWorkerPool struct {
+	mu        sync.Mutex
+	pool      *workerPool
+	size      int
+	queueSize int
+	// stopped は Shutdown 後に新しいプールを起動しないためのもの
+	stopped bool
+}
+
+// configureWorkers はワーカー数と処理待ちの上限を設定する。
+// 起動済みのプールがあれば受付を止めて残りの処理を実行させ、次の受付から新しい設定のプールを使う
+func configureWorkers(size, queueSize int) {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	workers.size, workers.queueSize = size, queueSize
+	if old := workers.pool; old != nil {
+		workers.pool = nil
+		go func() {
+			if err := old.Shutdown(context.Background()); err != nil {
+				log.Printf("Failed to stop previous slack worker pool: %v", err)
+			}
+		}()
+	}
+}
+
+// workerPoolForSubmit は起動済みのプールを返す（未起動なら起動する。Shutdown 後は nil）
+func workerPoolForSubmit() *workerPool {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	if workers.pool == nil && !workers.stopped {
+		workers.pool = newWorkerPool(workers.size, workers.queueSize)
+	}
+	return workers.pool
+}
+
+// queueDepth は処理待ちの件数（プールが未起動なら 0）
+func queueDepth() int {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	if workers.pool == nil {
+		return 0
+	}
+	return len(workers.pool.jobs)
+}
+
+// Shutdown は Slack の処理待ちを実行し終えるまで待つ（サーバー停止時に呼ぶ）
+func Shutdown(ctx context.Context) error {
+	workers.mu.Lock()
+	workers.stopped = true
+	p := workers.pool
+	workers.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.Shutdown(ctx)
+}
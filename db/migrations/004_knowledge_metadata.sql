@@ -0,0 +1,8 @@
+-- 自動生成されたタイトル案・要約・キーワードを本文とは別に保持する
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS summary TEXT;
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS keywords TEXT[];
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS suggested_title TEXT;
+
+COMMENT ON COLUMN knowledge.summary IS 'Short summary used in list views and /ask context';
+COMMENT ON COLUMN knowledge.keywords IS 'Search keywords (generated or author-provided)';
+COMMENT ON COLUMN knowledge.suggested_title IS 'Generated title suggestion awaiting author acceptance';
@@ -0,0 +1,8 @@
+-- 重複ナレッジのマージ後、旧IDから統合先IDへリダイレクトする
+CREATE TABLE IF NOT EXISTS knowledge_redirects (
+    old_id BIGINT PRIMARY KEY,
+    new_id BIGINT NOT NULL REFERENCES knowledge(id) ON DELETE CASCADE,
+    merged_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_redirects_new_id ON knowledge_redirects(new_id);
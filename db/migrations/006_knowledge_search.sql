@@ -0,0 +1,13 @@
+-- 日本語向け全文検索インデックス
+-- search_title / search_body にはアプリ側で生成した n-gram トークン（空白区切り）を保存する。
+-- CJK 文字は bi-gram + uni-gram、英数字は単語単位。
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS search_title TEXT;
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS search_body TEXT;
+
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(search_title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(search_body, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_search_vector ON knowledge USING GIN (search_vector);
@@ -0,0 +1,4 @@
+-- 保存時に検出したプロンプトインジェクションの疑い（パターン名の配列）
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS injection_flags TEXT[];
+
+COMMENT ON COLUMN knowledge.injection_flags IS 'Prompt-injection patterns detected at save time';
@@ -0,0 +1,16 @@
+-- 外部AIへ送信する前に伏せ字にする独自ルール
+-- org_id が NULL のルールは全組織に適用される
+CREATE TABLE IF NOT EXISTS redaction_rules (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT,
+    name TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    restore BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_redaction_rules_org_id ON redaction_rules(org_id);
+
+COMMENT ON COLUMN redaction_rules.pattern IS 'Go (RE2) regular expression';
+COMMENT ON COLUMN redaction_rules.restore IS 'Restore the original value in generated answers';
@@ -0,0 +1,18 @@
+-- 繰り返される質問への回答キャッシュ（質問の Embedding 類似度で照合する）
+CREATE TABLE IF NOT EXISTS answer_cache (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    question TEXT NOT NULL,
+    embedding vector(1536) NOT NULL,
+    answer TEXT NOT NULL,
+    knowledge_ids INTEGER[] NOT NULL DEFAULT '{}',
+    hit_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_cache_org_id ON answer_cache(org_id, expires_at);
+-- 引用ナレッジの更新・削除時の無効化用
+CREATE INDEX IF NOT EXISTS idx_answer_cache_knowledge_ids ON answer_cache USING GIN (knowledge_ids);
+
+COMMENT ON COLUMN answer_cache.knowledge_ids IS 'Knowledge entries the answer was grounded in; the row is deleted when any of them changes';
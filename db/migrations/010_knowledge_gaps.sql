@@ -0,0 +1,20 @@
+-- 回答できなかった質問（ナレッジ不足レポート用）
+CREATE TABLE IF NOT EXISTS unanswered_questions (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    question TEXT NOT NULL,
+    embedding vector(1536),
+    asked_by TEXT,
+    reason TEXT NOT NULL,
+    draft_knowledge_id BIGINT REFERENCES knowledge(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_unanswered_questions_org_created ON unanswered_questions(org_id, created_at);
+
+COMMENT ON COLUMN unanswered_questions.reason IS 'no_results: nothing was found, no_answer: the model could not answer from the results';
+COMMENT ON COLUMN unanswered_questions.draft_knowledge_id IS 'Draft created from the question''s cluster';
+
+-- 下書きのナレッジは検索・回答の対象外
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published';
+CREATE INDEX IF NOT EXISTS idx_knowledge_status ON knowledge(status);
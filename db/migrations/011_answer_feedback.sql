@@ -0,0 +1,12 @@
+-- 回答に対する「役に立った / 役に立たなかった」の評価
+CREATE TABLE IF NOT EXISTS answer_feedback (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    question TEXT NOT NULL,
+    knowledge_ids INTEGER[] NOT NULL DEFAULT '{}',
+    helpful BOOLEAN NOT NULL,
+    user_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_feedback_org_created ON answer_feedback(org_id, created_at);
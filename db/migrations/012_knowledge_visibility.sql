@@ -0,0 +1,3 @@
+-- タグと公開範囲（private は作成者のみが参照し、検索・回答の対象外）
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS tags TEXT[];
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public';
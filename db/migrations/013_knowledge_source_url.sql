@@ -0,0 +1,2 @@
+-- Slack スレッドなど、ナレッジの出典
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS source_url TEXT;
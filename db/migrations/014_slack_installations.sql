@@ -0,0 +1,15 @@
+-- OAuth でインストールされた Slack ワークスペースと組織・Bot トークンの対応
+CREATE TABLE IF NOT EXISTS slack_installations (
+    team_id TEXT PRIMARY KEY,
+    team_name TEXT NOT NULL DEFAULT '',
+    org_id BIGINT NOT NULL DEFAULT 0,
+    bot_token TEXT NOT NULL,
+    bot_user_id TEXT NOT NULL DEFAULT '',
+    scope TEXT NOT NULL DEFAULT '',
+    installed_by TEXT,
+    installed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- アンインストール・トークン失効の日時（再インストールで NULL に戻す）
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_slack_installations_org ON slack_installations(org_id);
@@ -0,0 +1,23 @@
+-- ナレッジの更新日時（ダイジェストで更新されたナレッジを抽出する）
+ALTER TABLE knowledge ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+UPDATE knowledge SET updated_at = COALESCE(created_at, NOW()) WHERE updated_at IS NULL;
+ALTER TABLE knowledge ALTER COLUMN updated_at SET DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS idx_knowledge_updated_at ON knowledge(updated_at);
+
+-- Slack チャンネルへ定期投稿するダイジェストの設定（組織・チャンネルごと）
+CREATE TABLE IF NOT EXISTS digest_settings (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    channel_id TEXT NOT NULL,
+    -- daily または weekly
+    frequency TEXT NOT NULL DEFAULT 'weekly' CHECK (frequency IN ('daily', 'weekly')),
+    -- weekly の場合の曜日（0 = 日曜）
+    weekday SMALLINT NOT NULL DEFAULT 1 CHECK (weekday BETWEEN 0 AND 6),
+    -- 投稿する時刻（timezone の現地時刻）
+    hour SMALLINT NOT NULL DEFAULT 9 CHECK (hour BETWEEN 0 AND 23),
+    timezone TEXT NOT NULL DEFAULT 'Asia/Tokyo',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, channel_id)
+);
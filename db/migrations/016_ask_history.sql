@@ -0,0 +1,15 @@
+-- 質問の履歴（Slack の App Home に本人の最近の質問を表示する）
+CREATE TABLE IF NOT EXISTS ask_history (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    asked_by TEXT NOT NULL,
+    question TEXT NOT NULL,
+    answer TEXT NOT NULL DEFAULT '',
+    knowledge_ids INTEGER[] NOT NULL DEFAULT '{}',
+    -- 関連ナレッジが見つからず回答できなかった場合は FALSE
+    answered BOOLEAN NOT NULL DEFAULT TRUE,
+    cached BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ask_history_asked_by_created ON ask_history(asked_by, created_at DESC);
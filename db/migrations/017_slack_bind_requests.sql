@@ -0,0 +1,13 @@
+-- Slack アカウント連携の確認コード（ユーザーごとに進行中の申請は1件）
+CREATE TABLE IF NOT EXISTS slack_bind_requests (
+    user_id TEXT PRIMARY KEY,
+    -- 申請時に入力された Slack メンバーID（確認コードの送信先）
+    slack_id TEXT NOT NULL,
+    -- 確認コードは SHA-256 ハッシュのみ保存する
+    code_hash BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_slack_bind_requests_expires_at ON slack_bind_requests(expires_at);
@@ -0,0 +1,19 @@
+-- メールアドレスによる Slack アカウントの自動連携で、自動では連携できなかったもの（管理者が確認する）
+CREATE TABLE IF NOT EXISTS slack_identity_conflicts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    -- メールアドレスから見つかった Slack メンバーID（複数の場合はカンマ区切り）
+    slack_id TEXT NOT NULL DEFAULT '',
+    team_id TEXT NOT NULL DEFAULT '',
+    -- slack_account_taken / bound_to_other_account / ambiguous_match
+    reason TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- 直近の同期で検出された日時（検出されなくなったら resolved_at を設定する）
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_slack_identity_conflicts_open
+    ON slack_identity_conflicts(user_id, slack_id, reason) WHERE resolved_at IS NULL;
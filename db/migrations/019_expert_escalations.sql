@@ -0,0 +1,33 @@
+-- タグごとの専門家（tag = '*' はどのタグにも該当しない質問の担当）
+CREATE TABLE IF NOT EXISTS tag_experts (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    tag TEXT NOT NULL,
+    slack_user_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, tag, slack_user_id)
+);
+
+-- ナレッジから回答できず専門家に転送した質問
+CREATE TABLE IF NOT EXISTS escalations (
+    id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    team_id TEXT NOT NULL DEFAULT '',
+    tag TEXT NOT NULL DEFAULT '',
+    question TEXT NOT NULL,
+    asker_slack_id TEXT NOT NULL,
+    -- 質問したスレッド（スラッシュコマンドなどスレッドがない場合は空で、回答はDMで届ける）
+    channel_id TEXT NOT NULL DEFAULT '',
+    thread_ts TEXT NOT NULL DEFAULT '',
+    expert_slack_id TEXT NOT NULL,
+    -- 専門家に送ったDM（回答後に更新する）
+    expert_channel_id TEXT NOT NULL DEFAULT '',
+    expert_message_ts TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'answered')),
+    answer TEXT NOT NULL DEFAULT '',
+    answered_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    answered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_escalations_expert_status ON escalations(org_id, expert_slack_id, status);
@@ -0,0 +1,3 @@
+-- 管理APIの対象組織をログイン中のユーザーから決めるため、users に所属組織を持たせる
+-- （auth サービスのスキーマで作成した場合は既に存在する）
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id BIGINT;
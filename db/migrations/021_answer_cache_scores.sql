@@ -0,0 +1,4 @@
+-- キャッシュした回答の根拠ナレッジの検索スコアと類似度（knowledge_ids と同じ順）。
+-- キャッシュから返すときも一致度を表示できるように保存する
+ALTER TABLE answer_cache ADD COLUMN IF NOT EXISTS knowledge_scores DOUBLE PRECISION[] NOT NULL DEFAULT '{}';
+ALTER TABLE answer_cache ADD COLUMN IF NOT EXISTS knowledge_similarities DOUBLE PRECISION[] NOT NULL DEFAULT '{}';
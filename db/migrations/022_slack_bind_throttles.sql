@@ -0,0 +1,12 @@
+-- Slack アカウント連携の申請間隔と確認コードの失敗回数（申請を取り消しても残す）。
+-- scope は user（Web アプリのユーザーID）または slack_id（確認コードの送信先）
+CREATE TABLE IF NOT EXISTS slack_bind_throttles (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    last_requested_at TIMESTAMPTZ,
+    -- last_failed_at から一定時間内の連続した失敗回数（上限に達すると locked_until まで申請・入力を拒否する）
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
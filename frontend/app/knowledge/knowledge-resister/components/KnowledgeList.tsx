@@ -91,6 +91,9 @@ export default function KnowledgeList({ knowledgeList, onEdit, onDelete }: Knowl
               color: '#1f2937',
               lineHeight: 1.4
             }}>
+              {knowledge.status === 'draft' && (
+                <span style={{ marginRight: '0.5rem', color: '#b45309' }}>[下書き]</span>
+              )}
               {knowledge.title}
             </h3>
             
@@ -112,9 +115,11 @@ export default function KnowledgeList({ knowledgeList, onEdit, onDelete }: Knowl
             lineHeight: 1.6,
             fontSize: '0.875rem'
           }}>
-            {knowledge.content.length > 150 
-              ? `${knowledge.content.substring(0, 150)}...` 
-              : knowledge.content
+            {knowledge.summary
+              ? knowledge.summary
+              : knowledge.content.length > 150 
+                ? `${knowledge.content.substring(0, 150)}...` 
+                : knowledge.content
             }
           </p>
 
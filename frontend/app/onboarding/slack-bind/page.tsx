@@ -16,7 +16,7 @@ export default function SlackBindPage() {
         body: JSON.stringify({ slack_id: slackID }) 
       });
       setSent(true); 
-      setMsg('Slack に確認コードを送信しました（開発中はログに出力）');
+      setMsg('Slack のDMに確認コードを送信しました（10分間有効）');
     } catch (error) {
       console.error('Failed to start slack binding:', error);
       setMsg('エラーが発生しました');
@@ -25,7 +25,7 @@ export default function SlackBindPage() {
 
   async function verify() {
     try {
-      await api(`/api/me/slack/verify?slack_id=${encodeURIComponent(slackID)}`, { 
+      await api('/api/me/slack/verify', { 
         method: 'POST', 
         body: JSON.stringify({ code }) 
       });
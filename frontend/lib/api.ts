@@ -4,6 +4,13 @@ export type Knowledge = {
   id: number;
   title: string;
   content: string;
+  summary?: string | null;
+  keywords?: string[] | null;
+  suggested_title?: string | null;
+  status?: 'published' | 'draft';
+  tags?: string[] | null;
+  visibility?: 'public' | 'private';
+  source_url?: string | null;
   user_id: string;
   created_at: string;
   updated_at: string;